@@ -11,7 +11,10 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"net"
 	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 )
 
@@ -43,11 +46,21 @@ type Reader struct {
 	err          error
 	lastByte     int // last byte read for UnreadByte; -1 means invalid
 	lastRuneSize int // size of last rune read for UnreadRune; -1 means invalid
+
+	// growable buffer, see NewReaderMax; max == 0 means a fixed size buffer
+	min, max int // buffer size bounds
+	small    int // consecutive fills of an empty grown buffer
+
+	size int // buffer size to borrow again after Release
 }
 
 const minReadBufferSize = 16
 const maxConsecutiveEmptyReads = 100
 
+// shrinkAfter is the number of consecutive fills of an empty buffer
+// after which a grown buffer is replaced by one of its initial size.
+const shrinkAfter = 16
+
 // NewReaderSize returns a new Reader whose buffer has at least the specified
 // size. If the argument io.Reader is already a Reader with large enough
 // size, it returns the underlying Reader.
@@ -61,7 +74,7 @@ func NewReaderSize(rd io.Reader, size int) *Reader {
 		size = minReadBufferSize
 	}
 	r := new(Reader)
-	r.reset(make([]byte, size), rd)
+	r.reset(bytes.GetSlice(size), rd)
 	return r
 }
 
@@ -70,21 +83,118 @@ func NewReader(rd io.Reader) *Reader {
 	return NewReaderSize(rd, defaultBufSize)
 }
 
+// NewReaderMax returns a new Reader whose buffer starts at size bytes
+// and grows on demand up to max bytes: Peek(n) and ReadSlice fail with
+// ErrBufferFull only once the data no longer fits in max bytes. After a
+// number of consecutive reads that would have fit in the initial size,
+// a grown buffer shrinks back to it.
+// 协议解析时可以直接 Peek 整个 frame，而不用预先猜一个足够大的 buffer
+func NewReaderMax(rd io.Reader, size, max int) *Reader {
+	if size < minReadBufferSize {
+		size = minReadBufferSize
+	}
+	if max < size {
+		max = size
+	}
+	r := new(Reader)
+	r.reset(bytes.GetSlice(size), rd)
+	r.min, r.max = size, max
+	return r
+}
+
 // Size returns the size of the underlying buffer in bytes.
 func (b *Reader) Size() int { return len(b.buf) }
 
 // Reset discards any buffered data, resets all state, and switches
-// the buffered reader to read from r.
+// the buffered reader to read from r. A Reader without a buffer, after
+// Release, borrows a new one from the shared slice pool.
 func (b *Reader) Reset(r io.Reader) {
+	if b.buf == nil {
+		size := b.size
+		if size == 0 {
+			size = defaultBufSize
+		}
+		b.buf = bytes.GetSlice(size)
+	}
 	b.reset(b.buf, r)
 }
 
+// Release discards any buffered data and gives the buffer back to the
+// shared slice pool (see bytes.GetSlice), so that an idle Reader holds
+// no memory. A later Reset borrows a buffer of the same size again.
+// Slices returned by Peek, ReadSlice and the like must not be used
+// after Release.
+// 替代 net/http 里私有的 bufioReaderPool，所有 Reader 共用一套按大小分级的 pool
+func (b *Reader) Release() {
+	if b.buf == nil {
+		return
+	}
+	size := len(b.buf)
+	if b.max > 0 {
+		size = b.min
+	}
+	bytes.PutSlice(b.buf)
+	b.reset(nil, nil)
+	b.size = size
+}
+
 func (b *Reader) reset(buf []byte, r io.Reader) {
 	*b = Reader{
 		buf:          buf,
 		rd:           r,
 		lastByte:     -1,
 		lastRuneSize: -1,
+		min:          b.min,
+		max:          b.max,
+	}
+}
+
+// grow enlarges a growable buffer so that it holds at least n bytes,
+// doubling its size but not beyond b.max. The unread data is moved to
+// the front of the new buffer. It reports whether the buffer grew.
+func (b *Reader) grow(n int) bool {
+	if len(b.buf) >= b.max {
+		return false
+	}
+	size := 2 * len(b.buf)
+	if size < n {
+		size = n
+	}
+	if size > b.max {
+		size = b.max
+	}
+	buf := bytes.GetSlice(size)
+	b.w = copy(buf, b.buf[b.r:b.w])
+	b.r = 0
+	if len(b.buf) > b.min {
+		// only a buffer grown here is ours to give back; the
+		// initial one may belong to the caller, see Scanner.Buffer
+		bytes.PutSlice(b.buf)
+	}
+	b.buf = buf
+	b.small = 0
+	return true
+}
+
+// maybeShrink gives back a grown buffer after shrinkAfter consecutive
+// fills of an empty buffer; a fill that finds more than half of the
+// initial size still pending starts the count again. It is called by
+// fill and Read just before reading into the buffer, with b.r == 0.
+func (b *Reader) maybeShrink() {
+	if len(b.buf) <= b.min {
+		return
+	}
+	if b.w > b.min/2 {
+		b.small = 0
+		return
+	}
+	if b.w > 0 {
+		return
+	}
+	if b.small++; b.small >= shrinkAfter {
+		bytes.PutSlice(b.buf)
+		b.buf = bytes.GetSlice(b.min)
+		b.small = 0
 	}
 }
 
@@ -143,6 +253,9 @@ func (b *Reader) fill() {
 		b.w -= b.r
 		b.r = 0
 	}
+	if b.max > 0 {
+		b.maybeShrink()
+	}
 
 	if b.w >= len(b.buf) {
 		panic("bufio: tried to fill full buffer")
@@ -176,7 +289,8 @@ func (b *Reader) readErr() error {
 // Peek returns the next n bytes without advancing the reader. The bytes stop
 // being valid at the next read call. If Peek returns fewer than n bytes, it
 // also returns an error explaining why the read is short. The error is
-// ErrBufferFull if n is larger than b's buffer size.
+// ErrBufferFull if n is larger than b's buffer size, or for a Reader
+// created by NewReaderMax, larger than its maximum size.
 //
 // Calling Peek prevents a UnreadByte or UnreadRune call from succeeding
 // until the next read operation.
@@ -188,6 +302,13 @@ func (b *Reader) Peek(n int) ([]byte, error) {
 	b.lastByte = -1
 	b.lastRuneSize = -1
 
+	if b.max > 0 && n > b.min {
+		b.small = 0 // a large Peek keeps a grown buffer alive
+		if n > len(b.buf) {
+			b.grow(n)
+		}
+	}
+
 	for b.w-b.r < n && b.w-b.r < len(b.buf) && b.err == nil {
 		b.fill() // b.w-b.r < len(b.buf) => buffer is not full
 	}
@@ -284,6 +405,9 @@ func (b *Reader) Read(p []byte) (n int, err error) {
 		// 而不是像 bytes.Buffer 那样让 GC 去回收内存
 		b.r = 0
 		b.w = 0
+		if b.max > 0 {
+			b.maybeShrink()
+		}
 		n, b.err = b.rd.Read(b.buf) // 可能发生 block
 		if n < 0 {
 			panic(errNegativeRead)
@@ -419,7 +543,7 @@ func (b *Reader) ReadSlice(delim byte) (line []byte, err error) {
 		}
 
 		// Buffer full?
-		if b.Buffered() >= len(b.buf) {
+		if b.Buffered() >= len(b.buf) && !(b.max > 0 && b.grow(0)) {
 			b.r = b.w
 			line = b.buf
 			err = ErrBufferFull
@@ -443,6 +567,89 @@ func (b *Reader) ReadSlice(delim byte) (line []byte, err error) {
 	return
 }
 
+// ReadSliceFunc is like ReadSlice but reads until the first byte c for
+// which f(c) is true, returning a slice pointing at the bytes in the
+// buffer, up to and including that byte. The bytes stop being valid at
+// the next read. As with ReadSlice, ReadSliceFunc fails with error
+// ErrBufferFull if the buffer fills without a match, and returns
+// err != nil if and only if line does not end in a matching byte.
+// f must not call methods of b.
+func (b *Reader) ReadSliceFunc(f func(c byte) bool) (line []byte, err error) {
+	return b.readSlice(func(p []byte) int {
+		for i, c := range p {
+			if f(c) {
+				return i
+			}
+		}
+		return -1
+	})
+}
+
+// ReadSliceAny is like ReadSlice but stops at the first occurrence of
+// any of the bytes in delims, e.g. "\r\n" or "\x00\n". Each byte of
+// delims is a delimiter on its own; delims is not decoded as UTF-8.
+func (b *Reader) ReadSliceAny(delims string) (line []byte, err error) {
+	if len(delims) == 1 {
+		return b.ReadSlice(delims[0])
+	}
+	var set [256]bool
+	for i := 0; i < len(delims); i++ {
+		set[delims[i]] = true
+	}
+	return b.readSlice(func(p []byte) int {
+		for i, c := range p {
+			if set[c] {
+				return i
+			}
+		}
+		return -1
+	})
+}
+
+// readSlice implements ReadSlice for an arbitrary delimiter search:
+// index returns the position of the first delimiter in p, or -1.
+// 与 ReadSlice 同样的逻辑：只扫描新填充的部分，找不到就 fill，buf 满了就 ErrBufferFull
+func (b *Reader) readSlice(index func(p []byte) int) (line []byte, err error) {
+	s := 0 // search start index
+	for {
+		// Search buffer.
+		if i := index(b.buf[b.r+s : b.w]); i >= 0 {
+			i += s
+			line = b.buf[b.r : b.r+i+1]
+			b.r += i + 1
+			break
+		}
+
+		// Pending error?
+		if b.err != nil {
+			line = b.buf[b.r:b.w]
+			b.r = b.w
+			err = b.readErr()
+			break
+		}
+
+		// Buffer full?
+		if b.Buffered() >= len(b.buf) && !(b.max > 0 && b.grow(0)) {
+			b.r = b.w
+			line = b.buf
+			err = ErrBufferFull
+			break
+		}
+
+		s = b.w - b.r // do not rescan area we scanned before
+
+		b.fill() // buffer is not full
+	}
+
+	// Handle last byte, if any.
+	if i := len(line) - 1; i >= 0 {
+		b.lastByte = int(line[i])
+		b.lastRuneSize = -1
+	}
+
+	return
+}
+
 // ReadLine is a low-level line-reading primitive. Most callers should use
 // ReadBytes('\n') or ReadString('\n') instead or use a Scanner.
 //
@@ -512,12 +719,17 @@ func (b *Reader) ReadLine() (line []byte, isPrefix bool, err error) {
 // finalFragment []byte: 最后一个分片
 // totalLen int        : 全部分片加起来的总长度
 func (b *Reader) collectFragments(delim byte) (fullBuffers [][]byte, finalFragment []byte, totalLen int, err error) {
+	return b.collect(func() ([]byte, error) { return b.ReadSlice(delim) })
+}
+
+// collect is collectFragments for any ReadSlice-like function.
+func (b *Reader) collect(readSlice func() ([]byte, error)) (fullBuffers [][]byte, finalFragment []byte, totalLen int, err error) {
 	var frag []byte
 	// Use ReadSlice to look for delim, accumulating full buffers.
 	// 当数据很长的时候，只能将数据拆成很多个小片段，而且 bufio.Reader 是环形缓冲，所以只能自己再次拷贝出来
 	for {
 		var e error
-		frag, e = b.ReadSlice(delim)
+		frag, e = readSlice()
 		if e == nil { // got final fragment
 			break
 		}
@@ -557,6 +769,23 @@ func (b *Reader) ReadBytes(delim byte) ([]byte, error) {
 	return buf, err
 }
 
+// ReadBytesFunc is like ReadBytes but reads until the first byte c for
+// which f(c) is true, returning a slice containing the data up to and
+// including that byte. The result is assembled with a single copy out
+// of the buffer, even for tokens longer than the buffer.
+// ReadBytesFunc returns err != nil if and only if the returned data does
+// not end in a matching byte. f must not call methods of b.
+func (b *Reader) ReadBytesFunc(f func(c byte) bool) ([]byte, error) {
+	full, frag, n, err := b.collect(func() ([]byte, error) { return b.ReadSliceFunc(f) })
+	buf := make([]byte, n)
+	n = 0
+	for i := range full {
+		n += copy(buf[n:], full[i])
+	}
+	copy(buf[n:], frag)
+	return buf, err
+}
+
 // ReadString reads until the first occurrence of delim in the input,
 // returning a string containing the data up to and including the delimiter.
 // If ReadString encounters an error before finding a delimiter,
@@ -648,6 +877,9 @@ type Writer struct {
 	buf []byte
 	n   int
 	wr  io.Writer
+	af  *autoFlush // nil unless SetFlushPolicy was called
+
+	size int // buffer size to borrow again after Release
 }
 
 // NewWriterSize returns a new Writer whose buffer has at least the specified
@@ -664,7 +896,7 @@ func NewWriterSize(w io.Writer, size int) *Writer {
 		size = defaultBufSize
 	}
 	return &Writer{
-		buf: make([]byte, size),
+		buf: bytes.GetSlice(size),
 		wr:  w,
 	}
 }
@@ -678,13 +910,41 @@ func NewWriter(w io.Writer) *Writer {
 func (b *Writer) Size() int { return len(b.buf) }
 
 // Reset discards any unflushed buffered data, clears any error, and
-// resets b to write its output to w.
+// resets b to write its output to w. A Writer without a buffer, after
+// Release, borrows a new one from the shared slice pool.
 func (b *Writer) Reset(w io.Writer) {
+	b.lock()
+	defer b.unlock()
+	if b.buf == nil {
+		size := b.size
+		if size == 0 {
+			size = defaultBufSize
+		}
+		b.buf = bytes.GetSlice(size)
+	}
 	b.err = nil
 	b.n = 0
 	b.wr = w
 }
 
+// Release discards any unflushed buffered data and gives the buffer
+// back to the shared slice pool (see bytes.GetSlice), so that an idle
+// Writer holds no memory. A later Reset borrows a buffer of the same
+// size again.
+func (b *Writer) Release() {
+	b.lock()
+	defer b.unlock()
+	if b.buf == nil {
+		return
+	}
+	b.size = len(b.buf)
+	bytes.PutSlice(b.buf)
+	b.buf = nil
+	b.err = nil
+	b.n = 0
+	b.wr = nil
+}
+
 // 说白了就是调用底层的 bufio.Writer.wr.Write(bufio.Writer.buf)
 // Flush writes any buffered data to the underlying io.Writer.
 // 可能是把 b.buf 全部往 b.wr 刷完才返回（block 式，没干完坚决不返回）
@@ -694,6 +954,12 @@ func (b *Writer) Reset(w io.Writer) {
 // bufio.Writer.Write(), bufio.Reader.Read() 具体行为，跟底层的 Writer, Reader 保持一致
 // bufio 仅仅是尽可能通过缓冲的形式，减少 write、read 操作的次数，一次尽可能多操作而已。并不改变原本 IO 的 block, non-block 行为
 func (b *Writer) Flush() error {
+	b.lock()
+	defer b.unlock()
+	return b.flush()
+}
+
+func (b *Writer) flush() error {
 	if b.err != nil {
 		return b.err
 	}
@@ -721,31 +987,55 @@ func (b *Writer) Flush() error {
 }
 
 // Available returns how many bytes are unused in the buffer.
-func (b *Writer) Available() int { return len(b.buf) - b.n }
+func (b *Writer) Available() int {
+	b.lock()
+	defer b.unlock()
+	return b.available()
+}
+
+func (b *Writer) available() int { return len(b.buf) - b.n }
 
 // Buffered returns the number of bytes that have been written into the current buffer.
-func (b *Writer) Buffered() int { return b.n }
+func (b *Writer) Buffered() int {
+	b.lock()
+	defer b.unlock()
+	return b.n
+}
 
 // Write writes the contents of p into the buffer.
 // It returns the number of bytes written.
 // If nn < len(p), it also returns an error explaining
 // why the write is short.
 func (b *Writer) Write(p []byte) (nn int, err error) {
-	for len(p) > b.Available() && b.err == nil {
+	b.lock()
+	defer b.unlock()
+	nn, err = b.write(p)
+	if b.af != nil {
+		b.autoFlush(bytes.IndexByte(p, '\n') >= 0)
+	}
+	return nn, err
+}
+
+func (b *Writer) write(p []byte) (nn int, err error) {
+	for len(p) > b.available() && b.err == nil {
 		// case-1: 针对大量数据待 wirte 或 case-2: bufio.Writer.buf 已经没有多少 buffer 空间 时：
 		// Writer 根本装不完要写入的数据，那就直接向 bufio.Writer.wr 写入数据
 		// bufio 的核心是减少 IO 操作的次数。既然数据都多到 bufio.Writer.buf 装不下了，
 		// 那么直接来一次 b.wr.Write(p) 也是相当实惠的一件事，必然是性价比很高的 IO 写入操作
 		var n int
-		if b.Buffered() == 0 {
+		if b.n == 0 {
 			// Large write, empty buffer.
 			// Write directly from p to avoid copy.
 			n, b.err = b.wr.Write(p)
+		} else if len(p) >= len(b.buf) {
+			// Large write behind buffered data.
+			// Send both in one vectored write rather than two.
+			n, _ = b.writev(p) // an error is kept in b.err
 		} else {
 			// 可能是 case-2: bufio.Writer.buf 已经没有多少 buffer 空间
 			n = copy(b.buf[b.n:], p)
 			b.n += n
-			b.Flush() // 尽可能多 flush 一些数据
+			b.flush() // 尽可能多 flush 一些数据
 		}
 		nn += n
 		p = p[n:] // 收缩，还剩下这么多数据没有 write
@@ -764,12 +1054,90 @@ func (b *Writer) Write(p []byte) (nn int, err error) {
 	return nn, nil
 }
 
+// WriteVec writes the contents of the slices in vec, in order.
+// It returns the number of bytes written.
+// If nn is less than the total length of vec, it also returns an error
+// explaining why the write is short.
+// If vec does not fit in the available buffer space, the buffered data
+// and vec are written together with a single net.Buffers write, which
+// becomes one writev(2) on connections that support it.
+// 典型场景：header 走 buffer，body 是调用方的大块 slice，一次 syscall 发出
+func (b *Writer) WriteVec(vec [][]byte) (nn int, err error) {
+	b.lock()
+	defer b.unlock()
+	if b.err != nil {
+		return 0, b.err
+	}
+	total, nl := 0, false
+	for _, p := range vec {
+		total += len(p)
+		if b.af != nil && !nl {
+			nl = bytes.IndexByte(p, '\n') >= 0
+		}
+	}
+	if total > b.available() {
+		nn, err = b.writev(vec...)
+	} else {
+		for _, p := range vec {
+			b.n += copy(b.buf[b.n:], p)
+		}
+		nn = total
+	}
+	if b.af != nil {
+		b.autoFlush(nl)
+	}
+	return nn, err
+}
+
+// writev writes the buffered data followed by vec to the underlying
+// io.Writer in one net.Buffers write. It returns the number of bytes
+// of vec written; whatever part of the buffered data was not written
+// stays buffered. An error is recorded in b.err.
+func (b *Writer) writev(vec ...[]byte) (nn int, err error) {
+	bufs := make(net.Buffers, 0, len(vec)+1)
+	if b.n > 0 {
+		bufs = append(bufs, b.buf[:b.n])
+	}
+	total := b.n
+	for _, p := range vec {
+		if len(p) > 0 {
+			bufs = append(bufs, p)
+			total += len(p)
+		}
+	}
+	n64, err := bufs.WriteTo(b.wr) // 可能发生 block
+	n := int(n64)
+	if n < total && err == nil {
+		err = io.ErrShortWrite
+	}
+	if n < b.n {
+		// not even the buffered data went out
+		copy(b.buf[0:b.n-n], b.buf[n:b.n])
+		b.n -= n
+	} else {
+		nn = n - b.n
+		b.n = 0
+	}
+	b.err = err
+	return nn, err
+}
+
 // WriteByte writes a single byte.
 func (b *Writer) WriteByte(c byte) error {
+	b.lock()
+	defer b.unlock()
+	err := b.writeByte(c)
+	if b.af != nil {
+		b.autoFlush(c == '\n')
+	}
+	return err
+}
+
+func (b *Writer) writeByte(c byte) error {
 	if b.err != nil {
 		return b.err
 	}
-	if b.Available() <= 0 && b.Flush() != nil {
+	if b.available() <= 0 && b.flush() != nil {
 		return b.err
 	}
 	b.buf[b.n] = c
@@ -780,9 +1148,19 @@ func (b *Writer) WriteByte(c byte) error {
 // WriteRune writes a single Unicode code point, returning
 // the number of bytes written and any error.
 func (b *Writer) WriteRune(r rune) (size int, err error) {
+	b.lock()
+	defer b.unlock()
+	size, err = b.writeRune(r)
+	if b.af != nil {
+		b.autoFlush(r == '\n')
+	}
+	return size, err
+}
+
+func (b *Writer) writeRune(r rune) (size int, err error) {
 	// Compare as uint32 to correctly handle negative runes.
 	if uint32(r) < utf8.RuneSelf {
-		err = b.WriteByte(byte(r))
+		err = b.writeByte(byte(r))
 		if err != nil {
 			return 0, err
 		}
@@ -791,15 +1169,15 @@ func (b *Writer) WriteRune(r rune) (size int, err error) {
 	if b.err != nil {
 		return 0, b.err
 	}
-	n := b.Available()
+	n := b.available()
 	if n < utf8.UTFMax {
-		if b.Flush(); b.err != nil {
+		if b.flush(); b.err != nil {
 			return 0, b.err
 		}
-		n = b.Available()
+		n = b.available()
 		if n < utf8.UTFMax {
 			// Can only happen if buffer is silly small.
-			return b.WriteString(string(r))
+			return b.writeString(string(r))
 		}
 	}
 	size = utf8.EncodeRune(b.buf[b.n:], r)
@@ -812,15 +1190,25 @@ func (b *Writer) WriteRune(r rune) (size int, err error) {
 // If the count is less than len(s), it also returns an error explaining
 // why the write is short.
 func (b *Writer) WriteString(s string) (int, error) {
+	b.lock()
+	defer b.unlock()
+	nn, err := b.writeString(s)
+	if b.af != nil {
+		b.autoFlush(strings.IndexByte(s, '\n') >= 0)
+	}
+	return nn, err
+}
+
+func (b *Writer) writeString(s string) (int, error) {
 	nn := 0
-	for len(s) > b.Available() && b.err == nil {
+	for len(s) > b.available() && b.err == nil {
 		// case-1: buf 装不下的话;
 		// case-2: buf 已经满了的话
 		n := copy(b.buf[b.n:], s)
 		b.n += n
 		nn += n
 		s = s[n:]
-		b.Flush()
+		b.flush()
 	}
 	if b.err != nil {
 		return nn, b.err
@@ -834,11 +1222,25 @@ func (b *Writer) WriteString(s string) (int, error) {
 // ReadFrom implements io.ReaderFrom. If the underlying writer
 // supports the ReadFrom method, and b has no buffered data yet,
 // this calls the underlying ReadFrom without buffering.
+//
+// With a flush policy set, the policy is applied once r is exhausted,
+// not while reading from it.
 func (b *Writer) ReadFrom(r io.Reader) (n int64, err error) {
+	b.lock()
+	defer b.unlock()
+	n, err = b.readFrom(r)
+	if b.af != nil {
+		// a line policy flushes every newline, so any left is new
+		b.autoFlush(bytes.IndexByte(b.buf[:b.n], '\n') >= 0)
+	}
+	return n, err
+}
+
+func (b *Writer) readFrom(r io.Reader) (n int64, err error) {
 	if b.err != nil {
 		return 0, b.err
 	}
-	if b.Buffered() == 0 {
+	if b.n == 0 {
 		if w, ok := b.wr.(io.ReaderFrom); ok {
 			n, err = w.ReadFrom(r)
 			b.err = err
@@ -847,8 +1249,8 @@ func (b *Writer) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 	var m int
 	for {
-		if b.Available() == 0 {
-			if err1 := b.Flush(); err1 != nil {
+		if b.available() == 0 {
+			if err1 := b.flush(); err1 != nil {
 				return n, err1
 			}
 		}
@@ -871,8 +1273,8 @@ func (b *Writer) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 	if err == io.EOF {
 		// If we filled the buffer exactly, flush preemptively.
-		if b.Available() == 0 {
-			err = b.Flush()
+		if b.available() == 0 {
+			err = b.flush()
 		} else {
 			err = nil
 		}
@@ -880,6 +1282,101 @@ func (b *Writer) ReadFrom(r io.Reader) (n int64, err error) {
 	return n, err
 }
 
+// A FlushPolicy makes a Writer flush on its own, without waiting for
+// its buffer to fill up or for an explicit call to Flush. The zero
+// value flushes only when the buffer is full, as a plain Writer does.
+// The conditions may be combined.
+type FlushPolicy struct {
+	// Line flushes the buffer after every write containing a newline.
+	Line bool
+
+	// MaxLatency, if positive, bounds how long data may stay buffered:
+	// a timer flushes the buffer at most MaxLatency after the first
+	// write into an empty buffer.
+	MaxLatency time.Duration
+
+	// Threshold, if positive, flushes the buffer after a write leaves
+	// at least Threshold bytes buffered.
+	Threshold int
+}
+
+// autoFlush is the state of a Writer with a flush policy. mu serializes
+// the Writer's methods with the MaxLatency timer.
+type autoFlush struct {
+	FlushPolicy
+	mu    sync.Mutex
+	timer *time.Timer
+	armed bool // timer is pending
+}
+
+// SetFlushPolicy sets the flush policy of b; see FlushPolicy. Once a
+// policy has been set, the methods of b may be called concurrently with
+// each other. Errors of automatic flushes are sticky like those of
+// explicit ones and are returned by the next call on b.
+// The first call to SetFlushPolicy is what makes the methods of b lock,
+// so it must happen before b is shared between goroutines; later calls,
+// which change the policy, may run concurrently with the other methods.
+// 用于 SSE、tail -f 之类的交互式输出，调用方不必再记得手动 Flush
+func (b *Writer) SetFlushPolicy(p FlushPolicy) {
+	if b.af == nil {
+		b.af = new(autoFlush)
+	}
+	b.af.mu.Lock()
+	defer b.af.mu.Unlock()
+	if b.af.timer != nil {
+		b.af.timer.Stop()
+		b.af.armed = false
+	}
+	b.af.FlushPolicy = p
+	b.autoFlush(false)
+}
+
+// lock and unlock guard a Writer that has a flush policy; a plain Writer
+// is no more concurrency-safe than it ever was.
+func (b *Writer) lock() {
+	if b.af != nil {
+		b.af.mu.Lock()
+	}
+}
+
+func (b *Writer) unlock() {
+	if b.af != nil {
+		b.af.mu.Unlock()
+	}
+}
+
+// autoFlush applies the flush policy after a write; nl reports whether
+// the written data contained a newline. It must be called with b.af.mu
+// held.
+func (b *Writer) autoFlush(nl bool) {
+	af := b.af
+	if b.err != nil || b.n == 0 {
+		return
+	}
+	if (af.Line && nl) || (af.Threshold > 0 && b.n >= af.Threshold) {
+		b.flush()
+		return
+	}
+	if af.MaxLatency > 0 && !af.armed {
+		if af.timer == nil {
+			af.timer = time.AfterFunc(af.MaxLatency, b.timedFlush)
+		} else {
+			af.timer.Reset(af.MaxLatency)
+		}
+		af.armed = true
+	}
+}
+
+// timedFlush runs when the MaxLatency timer fires.
+func (b *Writer) timedFlush() {
+	b.af.mu.Lock()
+	defer b.af.mu.Unlock()
+	b.af.armed = false
+	if b.n > 0 {
+		b.flush() // an error is kept in b.err
+	}
+}
+
 // buffered input and output
 
 // ReadWriter stores pointers to a Reader and a Writer.
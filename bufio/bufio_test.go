@@ -0,0 +1,572 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufio_test
+
+import (
+	. "bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// lockedWriter records what is written to it; the MaxLatency timer
+// writes from its own goroutine.
+type lockedWriter struct {
+	mu     sync.Mutex
+	b      strings.Builder
+	writes int
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	return w.b.Write(p)
+}
+
+func (w *lockedWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.b.String()
+}
+
+// waitFor polls until w holds want or a second has passed.
+func waitFor(t *testing.T, w *lockedWriter, want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for w.String() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q; want %q", w.String(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushPolicyLine(t *testing.T) {
+	var out lockedWriter
+	w := NewWriter(&out)
+	w.SetFlushPolicy(FlushPolicy{Line: true})
+	w.WriteString("abc")
+	if s := out.String(); s != "" {
+		t.Fatalf("flushed %q before a newline", s)
+	}
+	w.WriteByte('\n')
+	if s := out.String(); s != "abc\n" {
+		t.Fatalf("after WriteByte('\\n'): %q", s)
+	}
+	w.Write([]byte("x\ny"))
+	if s := out.String(); s != "abc\nx\ny" {
+		t.Errorf("after Write: %q", s)
+	}
+	w.WriteRune('z')
+	if w.Buffered() != 1 {
+		t.Errorf("Buffered() = %d after a rune without newline; want 1", w.Buffered())
+	}
+}
+
+func TestFlushPolicyThreshold(t *testing.T) {
+	var out lockedWriter
+	w := NewWriter(&out)
+	w.SetFlushPolicy(FlushPolicy{Threshold: 4})
+	w.WriteString("abc")
+	if s := out.String(); s != "" {
+		t.Fatalf("flushed %q below the threshold", s)
+	}
+	w.WriteRune('d')
+	if s := out.String(); s != "abcd" {
+		t.Errorf("output at the threshold = %q; want %q", s, "abcd")
+	}
+
+	// data already buffered is flushed when the policy is set
+	out = lockedWriter{}
+	w = NewWriter(&out)
+	w.WriteString("hello")
+	w.SetFlushPolicy(FlushPolicy{Threshold: 4})
+	if s := out.String(); s != "hello" {
+		t.Errorf("SetFlushPolicy left %q unflushed", "hello")
+	}
+}
+
+func TestFlushPolicyMaxLatency(t *testing.T) {
+	var out lockedWriter
+	w := NewWriter(&out)
+	w.SetFlushPolicy(FlushPolicy{MaxLatency: 10 * time.Millisecond})
+	w.WriteString("a")
+	w.WriteString("b")
+	if s := out.String(); s != "" {
+		t.Fatalf("flushed %q before MaxLatency", s)
+	}
+	waitFor(t, &out, "ab")
+	if out.writes != 1 {
+		t.Errorf("timer flushed in %d writes; want 1", out.writes)
+	}
+
+	// the timer is armed again by the next write
+	w.WriteString("c")
+	waitFor(t, &out, "abc")
+}
+
+func TestFlushPolicyConcurrent(t *testing.T) {
+	var out lockedWriter
+	w := NewWriter(&out)
+	w.SetFlushPolicy(FlushPolicy{MaxLatency: time.Millisecond})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.WriteString("ab")
+				if j%10 == 0 {
+					w.Flush()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	waitFor(t, &out, strings.Repeat("ab", 400))
+}
+
+func TestFlushPolicyChange(t *testing.T) {
+	var out lockedWriter
+	w := NewWriter(&out)
+	w.SetFlushPolicy(FlushPolicy{Line: true}) // before w is shared
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			w.WriteString("ab\n")
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		w.SetFlushPolicy(FlushPolicy{Line: i%2 == 0, MaxLatency: time.Millisecond})
+	}
+	wg.Wait()
+	w.Flush()
+	if s := out.String(); s != strings.Repeat("ab\n", 100) {
+		t.Errorf("output = %q", s)
+	}
+}
+
+type errorWriter struct{}
+
+func (errorWriter) Write(p []byte) (int, error) { return 0, errors.New("boom") }
+
+func TestFlushPolicyTimerError(t *testing.T) {
+	w := NewWriter(errorWriter{})
+	w.SetFlushPolicy(FlushPolicy{MaxLatency: time.Millisecond})
+	w.WriteString("x")
+	time.Sleep(20 * time.Millisecond)
+	if _, err := w.WriteString("y"); err == nil || err.Error() != "boom" {
+		t.Errorf("Write after a failed timed flush = %v; want boom", err)
+	}
+	if err := w.Flush(); err == nil {
+		t.Error("Flush after a failed timed flush succeeded")
+	}
+}
+
+type readSliceTest struct {
+	in     string
+	delims string
+	tokens []string
+	errs   []error
+}
+
+// The Readers in these tests have a 16-byte buffer.
+var readSliceTests = []readSliceTest{
+	{"hello\r\nworld", "\r\n", []string{"hello\r", "\n", "world"}, []error{nil, nil, io.EOF}},
+	{"a;b,c", ";,", []string{"a;", "b,", "c"}, []error{nil, nil, io.EOF}},
+	{"a;", ";,", []string{"a;", ""}, []error{nil, io.EOF}},
+	{"", ";", []string{""}, []error{io.EOF}},
+	{"no delimiter", ";,", []string{"no delimiter"}, []error{io.EOF}},
+	// the delimiter is the last byte of a full buffer
+	{strings.Repeat("x", 15) + ";y", ";,", []string{strings.Repeat("x", 15) + ";", "y"}, []error{nil, io.EOF}},
+	// the delimiter is the first byte after a full buffer
+	{strings.Repeat("x", 16) + ";y", ";,", []string{strings.Repeat("x", 16), ";", "y"}, []error{ErrBufferFull, nil, io.EOF}},
+	// an empty set matches nothing
+	{"abc", "", []string{"abc"}, []error{io.EOF}},
+	{strings.Repeat("x", 20), "", []string{strings.Repeat("x", 16), "xxxx"}, []error{ErrBufferFull, io.EOF}},
+}
+
+// readSlices calls read until it returns an error other than
+// ErrBufferFull and returns the tokens and errors it returned.
+func readSlices(read func() ([]byte, error)) (tokens []string, errs []error) {
+	for {
+		line, err := read()
+		tokens = append(tokens, string(line))
+		errs = append(errs, err)
+		if err != nil && err != ErrBufferFull {
+			return tokens, errs
+		}
+	}
+}
+
+func sameTokens(tokens []string, errs []error, tt readSliceTest) bool {
+	if len(tokens) != len(tt.tokens) {
+		return false
+	}
+	for i := range tokens {
+		if tokens[i] != tt.tokens[i] || errs[i] != tt.errs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReadSliceAny(t *testing.T) {
+	for _, tt := range readSliceTests {
+		for _, r := range []io.Reader{strings.NewReader(tt.in), iotest.OneByteReader(strings.NewReader(tt.in))} {
+			b := NewReaderSize(r, 16)
+			tokens, errs := readSlices(func() ([]byte, error) { return b.ReadSliceAny(tt.delims) })
+			if !sameTokens(tokens, errs, tt) {
+				t.Errorf("ReadSliceAny(%q) of %q = %q, %v; want %q, %v", tt.delims, tt.in, tokens, errs, tt.tokens, tt.errs)
+			}
+		}
+	}
+}
+
+func TestReadSliceFunc(t *testing.T) {
+	for _, tt := range readSliceTests {
+		isDelim := func(c byte) bool { return strings.IndexByte(tt.delims, c) >= 0 }
+		for _, r := range []io.Reader{strings.NewReader(tt.in), iotest.OneByteReader(strings.NewReader(tt.in))} {
+			b := NewReaderSize(r, 16)
+			tokens, errs := readSlices(func() ([]byte, error) { return b.ReadSliceFunc(isDelim) })
+			if !sameTokens(tokens, errs, tt) {
+				t.Errorf("ReadSliceFunc(%q) of %q = %q, %v; want %q, %v", tt.delims, tt.in, tokens, errs, tt.tokens, tt.errs)
+			}
+		}
+	}
+}
+
+func TestReadSliceFuncUnreadByte(t *testing.T) {
+	b := NewReaderSize(strings.NewReader("key=value"), 16)
+	line, err := b.ReadSliceFunc(func(c byte) bool { return c == '=' })
+	if string(line) != "key=" || err != nil {
+		t.Fatalf("ReadSliceFunc = %q, %v", line, err)
+	}
+	if err := b.UnreadByte(); err != nil {
+		t.Fatalf("UnreadByte: %v", err)
+	}
+	if c, _ := b.ReadByte(); c != '=' {
+		t.Errorf("ReadByte after UnreadByte = %q; want '='", c)
+	}
+}
+
+func TestReadBytesFunc(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	isDelim := func(c byte) bool { return c == ';' || c == '\n' }
+	for _, r := range []io.Reader{strings.NewReader(long + ";a\nb"), iotest.OneByteReader(strings.NewReader(long + ";a\nb"))} {
+		b := NewReaderSize(r, 16)
+		tokens, errs := readSlices(func() ([]byte, error) { return b.ReadBytesFunc(isDelim) })
+		tt := readSliceTest{tokens: []string{long + ";", "a\n", "b"}, errs: []error{nil, nil, io.EOF}}
+		if !sameTokens(tokens, errs, tt) {
+			t.Errorf("ReadBytesFunc = %q, %v; want %q, %v", tokens, errs, tt.tokens, tt.errs)
+		}
+	}
+}
+
+func TestNewReaderMaxPeek(t *testing.T) {
+	data := strings.Repeat("x", 100) + "\n" + strings.Repeat("y", 300)
+	b := NewReaderMax(iotest.OneByteReader(strings.NewReader(data)), 16, 128)
+	if b.Size() != 16 {
+		t.Fatalf("initial Size() = %d; want 16", b.Size())
+	}
+	if p, err := b.Peek(101); string(p) != data[:101] || err != nil {
+		t.Fatalf("Peek(101) = %q, %v", p, err)
+	}
+	if b.Size() < 101 || b.Size() > 128 {
+		t.Errorf("Size() after Peek(101) = %d; want between 101 and 128", b.Size())
+	}
+	if p, err := b.Peek(129); len(p) != 128 || err != ErrBufferFull {
+		t.Errorf("Peek(129) = %d bytes, %v; want 128, ErrBufferFull", len(p), err)
+	}
+	if b.Size() != 128 {
+		t.Errorf("Size() after Peek past max = %d; want 128", b.Size())
+	}
+}
+
+func TestNewReaderMaxReadSlice(t *testing.T) {
+	data := strings.Repeat("x", 100) + "\n" + strings.Repeat("y", 200) + "\n"
+	b := NewReaderMax(iotest.OneByteReader(strings.NewReader(data)), 16, 128)
+	if line, err := b.ReadSlice('\n'); string(line) != data[:101] || err != nil {
+		t.Fatalf("ReadSlice = %d bytes, %v; want 101, nil", len(line), err)
+	}
+	if line, err := b.ReadSlice('\n'); len(line) != 128 || err != ErrBufferFull {
+		t.Fatalf("ReadSlice of a token longer than max = %d bytes, %v; want 128, ErrBufferFull", len(line), err)
+	}
+	if line, err := b.ReadSlice('\n'); len(line) != 73 || err != nil {
+		t.Errorf("ReadSlice of the rest = %d bytes, %v; want 73, nil", len(line), err)
+	}
+}
+
+func TestNewReaderMaxShrink(t *testing.T) {
+	data := strings.Repeat("x", 100) + "\n" + strings.Repeat("a\n", 40)
+	b := NewReaderMax(iotest.OneByteReader(strings.NewReader(data)), 16, 4096)
+	if _, err := b.ReadSlice('\n'); err != nil {
+		t.Fatal(err)
+	}
+	grown := b.Size()
+	if grown <= 16 {
+		t.Fatalf("Size() after a long line = %d; want more than 16", grown)
+	}
+	for i := 0; i < 40; i++ {
+		if line, err := b.ReadSlice('\n'); string(line) != "a\n" || err != nil {
+			t.Fatalf("line %d = %q, %v", i, line, err)
+		}
+	}
+	if b.Size() != 16 {
+		t.Errorf("Size() after many short lines = %d; want 16 (was %d)", b.Size(), grown)
+	}
+}
+
+func TestNewReaderMaxArgs(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	tests := []struct {
+		size, max int
+		wantSize  int // initial size
+		wantMax   int // size after a Peek past max
+	}{
+		{32, 16, 32, 32}, // max below size is raised to it
+		{0, 0, 16, 16},   // the minimum size, not growable
+		{-1, -1, 16, 16},
+		{-1, 24, 16, 24},
+	}
+	for _, tt := range tests {
+		b := NewReaderMax(strings.NewReader(long), tt.size, tt.max)
+		if b.Size() != tt.wantSize {
+			t.Errorf("NewReaderMax(%d, %d).Size() = %d; want %d", tt.size, tt.max, b.Size(), tt.wantSize)
+		}
+		if _, err := b.Peek(len(long)); err != ErrBufferFull {
+			t.Errorf("NewReaderMax(%d, %d).Peek(%d) = %v; want ErrBufferFull", tt.size, tt.max, len(long), err)
+		}
+		if b.Size() != tt.wantMax {
+			t.Errorf("NewReaderMax(%d, %d) grew to %d; want %d", tt.size, tt.max, b.Size(), tt.wantMax)
+		}
+	}
+}
+
+// limitedWriter records what is written to it and fails once it holds
+// max bytes.
+type limitedWriter struct {
+	b      strings.Builder
+	max    int
+	writes int
+}
+
+var errLimit = errors.New("limit reached")
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if room := w.max - w.b.Len(); len(p) > room {
+		w.b.Write(p[:room])
+		return room, errLimit
+	}
+	return w.b.Write(p)
+}
+
+func TestWriteVec(t *testing.T) {
+	out := &limitedWriter{max: 1 << 20}
+	w := NewWriterSize(out, 16)
+	body := strings.Repeat("b", 40)
+
+	// fits: buffered, nothing written yet
+	if n, err := w.WriteVec([][]byte{[]byte("ab"), nil, []byte("cd")}); n != 4 || err != nil {
+		t.Fatalf("small WriteVec = %d, %v", n, err)
+	}
+	if out.b.Len() != 0 || w.Buffered() != 4 {
+		t.Fatalf("small WriteVec wrote %d bytes, buffered %d; want 0, 4", out.b.Len(), w.Buffered())
+	}
+
+	// larger than the buffer: written behind the buffered data
+	if n, err := w.WriteVec([][]byte{[]byte("x"), []byte(body)}); n != 41 || err != nil {
+		t.Fatalf("large WriteVec = %d, %v", n, err)
+	}
+	if got, want := out.b.String(), "abcdx"+body; got != want || w.Buffered() != 0 {
+		t.Fatalf("after large WriteVec: %q, buffered %d; want %q, 0", got, w.Buffered(), want)
+	}
+
+	// a large Write behind buffered data takes the same path
+	w.WriteString("hdr:")
+	if n, err := w.Write([]byte(body)); n != 40 || err != nil {
+		t.Fatalf("large Write = %d, %v", n, err)
+	}
+	if got, want := out.b.String(), "abcdx"+body+"hdr:"+body; got != want || w.Buffered() != 0 {
+		t.Errorf("after large Write: %q, buffered %d; want %q, 0", got, w.Buffered(), want)
+	}
+}
+
+func TestWriteVecError(t *testing.T) {
+	for _, max := range []int{2, 10} {
+		out := &limitedWriter{max: max}
+		w := NewWriterSize(out, 16)
+		w.WriteString("hdr:")
+		n, err := w.WriteVec([][]byte{[]byte(strings.Repeat("b", 20))})
+		if err != errLimit {
+			t.Fatalf("max %d: WriteVec = %d, %v; want errLimit", max, n, err)
+		}
+		want := max - 4 // the header goes first
+		if want < 0 {
+			want = 0
+		}
+		if n != want {
+			t.Errorf("max %d: WriteVec wrote %d bytes of the vector; want %d", max, n, want)
+		}
+		if max < 4 && w.Buffered() != 4-max {
+			t.Errorf("max %d: Buffered() = %d; want the unwritten header, %d", max, w.Buffered(), 4-max)
+		}
+
+		// the error is sticky
+		writes := out.writes
+		if _, err := w.Write([]byte(strings.Repeat("c", 20))); err != errLimit {
+			t.Errorf("max %d: Write after the error = %v", max, err)
+		}
+		if _, err := w.WriteVec([][]byte{[]byte("d")}); err != errLimit {
+			t.Errorf("max %d: WriteVec after the error = %v", max, err)
+		}
+		if err := w.Flush(); err != errLimit {
+			t.Errorf("max %d: Flush after the error = %v", max, err)
+		}
+		if out.writes != writes {
+			t.Errorf("max %d: %d writes after the error", max, out.writes-writes)
+		}
+	}
+}
+
+// tcpPair returns the two ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (client, server net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	if server == nil {
+		t.Fatal("Accept failed")
+	}
+	return client, server
+}
+
+func TestWriteVecConn(t *testing.T) {
+	client, server := tcpPair(t)
+	defer server.Close()
+	received := make(chan string, 1)
+	go func() {
+		b, _ := io.ReadAll(server)
+		received <- string(b)
+	}()
+
+	w := NewWriterSize(client, 16)
+	body := strings.Repeat("b", 100)
+	w.WriteString("hdr:")
+	if n, err := w.WriteVec([][]byte{[]byte("x"), []byte(body)}); n != 101 || err != nil {
+		t.Fatalf("WriteVec = %d, %v", n, err)
+	}
+	w.WriteString("end")
+	w.Flush()
+	client.Close()
+	if got, want := <-received, "hdr:x"+body+"end"; got != want {
+		t.Errorf("received %q; want %q", got, want)
+	}
+}
+
+func TestWriteVecConnShort(t *testing.T) {
+	client, server := tcpPair(t)
+	defer server.Close()
+	if tc, ok := client.(*net.TCPConn); ok {
+		tc.SetWriteBuffer(4096)
+	}
+
+	// nobody reads, so the write stops once the socket buffers are full
+	w := NewWriterSize(client, 16)
+	body := strings.Repeat("b", 32<<20)
+	w.WriteString("hdr:")
+	client.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := w.WriteVec([][]byte{[]byte(body)})
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("WriteVec into a stalled connection = %d, %v; want a timeout", n, err)
+	}
+	if n >= len(body) {
+		t.Fatalf("WriteVec wrote all of %d bytes", n)
+	}
+	if _, err2 := w.WriteString("more"); err2 != err {
+		t.Errorf("WriteString after the timeout = %v; want %v", err2, err)
+	}
+	buffered := w.Buffered()
+	client.Close()
+
+	got, _ := io.ReadAll(server)
+	if want := ("hdr:" + body)[:len(got)]; string(got) != want {
+		t.Fatalf("received %d bytes that are not a prefix of the data", len(got))
+	}
+	if len(got) >= 4 && (n != len(got)-4 || buffered != 0) || len(got) < 4 && (n != 0 || buffered != 4-len(got)) {
+		t.Errorf("received %d bytes; WriteVec reported %d, with %d still buffered", len(got), n, buffered)
+	}
+}
+
+func TestReaderRelease(t *testing.T) {
+	r := NewReaderSize(strings.NewReader("abcdef"), 1024)
+	if c, _ := r.ReadByte(); c != 'a' {
+		t.Fatalf("ReadByte = %q", c)
+	}
+	r.Release()
+	if r.Size() != 0 || r.Buffered() != 0 {
+		t.Errorf("after Release: Size %d, Buffered %d; want 0, 0", r.Size(), r.Buffered())
+	}
+	r.Release() // a second Release does nothing
+	r.Reset(strings.NewReader("xyz"))
+	if r.Size() != 1024 {
+		t.Errorf("Size() after Release and Reset = %d; want 1024", r.Size())
+	}
+	if s, err := r.ReadString('z'); s != "xyz" || err != nil {
+		t.Errorf("ReadString after Reset = %q, %v", s, err)
+	}
+
+	// a growable Reader borrows its initial size again
+	r = NewReaderMax(strings.NewReader(strings.Repeat("x", 100)), 16, 256)
+	r.Peek(100)
+	r.Release()
+	r.Reset(strings.NewReader(""))
+	if r.Size() != 16 {
+		t.Errorf("NewReaderMax Size() after Release and Reset = %d; want 16", r.Size())
+	}
+}
+
+func TestWriterRelease(t *testing.T) {
+	out := &limitedWriter{max: 1 << 20}
+	w := NewWriterSize(out, 2048)
+	w.WriteString("dropped")
+	w.Release()
+	if w.Size() != 0 || w.Buffered() != 0 {
+		t.Errorf("after Release: Size %d, Buffered %d; want 0, 0", w.Size(), w.Buffered())
+	}
+	w.Reset(out)
+	w.WriteString("kept")
+	w.Flush()
+	if s := out.b.String(); s != "kept" || w.Size() != 2048 {
+		t.Errorf("after Release and Reset: wrote %q, Size %d; want %q, 2048", s, w.Size(), "kept")
+	}
+
+	// Reset of a zero Writer borrows the default size
+	var z Writer
+	z.Reset(out)
+	if z.Size() != 4096 {
+		t.Errorf("zero Writer Size() after Reset = %d; want 4096", z.Size())
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bufio_test
+
+import (
+	. "bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scanAll runs a Scanner with the given split function over in, read
+// whole and one byte at a time, and checks the tokens and the error.
+func scanAll(t *testing.T, name string, in string, split SplitFunc, want []string, wantErr error) {
+	t.Helper()
+	for _, r := range []io.Reader{strings.NewReader(in), iotest.OneByteReader(strings.NewReader(in))} {
+		s := NewScanner(r)
+		s.Split(split)
+		var got []string
+		for s.Scan() {
+			got = append(got, s.Text())
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) || s.Err() != wantErr {
+			t.Errorf("%s(%q) = %q, %v; want %q, %v", name, in, got, s.Err(), want, wantErr)
+		}
+	}
+}
+
+var lineTests = []struct {
+	in   string
+	want []string
+}{
+	{"", nil},
+	{"\n", []string{""}},
+	{"abc", []string{"abc"}},
+	{"abc\n", []string{"abc"}},
+	{"a\nb\n\nc", []string{"a", "b", "", "c"}},
+	{"a\r\nb\r\n", []string{"a", "b"}},
+	{"\r\n\r\n", []string{"", ""}},
+	{"a\rb\n", []string{"a\rb"}}, // only a \r before the \n is dropped
+	{"a\r\r\n", []string{"a\r"}},
+	{"last\r", []string{"last"}}, // the final line loses its \r too
+}
+
+func TestScanLines(t *testing.T) {
+	for _, tt := range lineTests {
+		scanAll(t, "ScanLines", tt.in, ScanLines, tt.want, nil)
+	}
+}
+
+func TestScanLinesLong(t *testing.T) {
+	// longer than the initial buffer, so the Scanner must grow
+	long := strings.Repeat("x", 10000)
+	scanAll(t, "ScanLines", long+"\r\nshort\n"+long, ScanLines, []string{long, "short", long}, nil)
+}
+
+var wordTests = []struct {
+	in   string
+	want []string
+}{
+	{"", nil},
+	{" ", nil},
+	{"\n", nil},
+	{"a", []string{"a"}},
+	{" a ", []string{"a"}},
+	{"abc def", []string{"abc", "def"}},
+	{" abc\tdef\r\nghi  ", []string{"abc", "def", "ghi"}},
+	{"héllo wörld end　", []string{"héllo", "wörld", "end"}},
+	{"  x\u0085y", []string{"x", "y"}},
+}
+
+func TestScanWords(t *testing.T) {
+	for _, tt := range wordTests {
+		scanAll(t, "ScanWords", tt.in, ScanWords, tt.want, nil)
+	}
+}
+
+// Test that the word splitter's notion of space matches unicode.IsSpace,
+// which it does not import.
+func TestSpace(t *testing.T) {
+	for r := rune(0); r <= utf8.MaxRune; r++ {
+		if IsSpace(r) != unicode.IsSpace(r) {
+			t.Fatalf("white space property disagrees: %#U should be %t", r, unicode.IsSpace(r))
+		}
+	}
+}
+
+var runeTests = []struct {
+	in   string
+	want []string
+}{
+	{"", nil},
+	{"abc", []string{"a", "b", "c"}},
+	{"héllo", []string{"h", "é", "l", "l", "o"}},
+	{"⌘\U0001F600", []string{"⌘", "\U0001F600"}},
+	{"a\xffb", []string{"a", "�", "b"}},      // invalid byte
+	{"\xe2\x8c", []string{"�", "�"}},         // incomplete at EOF
+	{"\xe2\x8c\x98\xe2", []string{"⌘", "�"}}, // valid, then cut short
+	{"�", []string{"�"}},                     // a real replacement rune
+}
+
+func TestScanRunes(t *testing.T) {
+	for _, tt := range runeTests {
+		scanAll(t, "ScanRunes", tt.in, ScanRunes, tt.want, nil)
+	}
+}
+
+func TestScanBytes(t *testing.T) {
+	scanAll(t, "ScanBytes", "a\xffé", ScanBytes, []string{"a", "\xff", "\xc3", "\xa9"}, nil)
+	scanAll(t, "ScanBytes", "", ScanBytes, nil, nil)
+}
+
+// frame prefixes the payload p with its length encoded as h.
+func frame(h FrameLength, p string) string {
+	n := len(p)
+	var hdr []byte
+	switch h {
+	case FrameUvarint:
+		for ; n >= 0x80; n >>= 7 {
+			hdr = append(hdr, byte(n)|0x80)
+		}
+		hdr = append(hdr, byte(n))
+	case FrameUint16BE:
+		hdr = []byte{byte(n >> 8), byte(n)}
+	case FrameUint16LE:
+		hdr = []byte{byte(n), byte(n >> 8)}
+	case FrameUint32BE:
+		hdr = []byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	case FrameUint32LE:
+		hdr = []byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}
+	}
+	return string(hdr) + p
+}
+
+var frameLengths = []struct {
+	h    FrameLength
+	name string
+}{
+	{FrameUvarint, "FrameUvarint"},
+	{FrameUint16BE, "FrameUint16BE"},
+	{FrameUint16LE, "FrameUint16LE"},
+	{FrameUint32BE, "FrameUint32BE"},
+	{FrameUint32LE, "FrameUint32LE"},
+}
+
+func TestScanFrames(t *testing.T) {
+	payloads := []string{"", "a", "hello, world", strings.Repeat("z", 300), strings.Repeat("y", 10000)}
+	for _, fl := range frameLengths {
+		var in string
+		for _, p := range payloads {
+			in += frame(fl.h, p)
+		}
+		scanAll(t, fl.name, in, ScanFrames(fl.h), payloads, nil)
+
+		// the same split function works on a buffer it is fed in halves
+		s := NewScanner(iotest.HalfReader(strings.NewReader(in)))
+		s.Split(ScanFrames(fl.h))
+		n := 0
+		for ; s.Scan(); n++ {
+			if s.Text() != payloads[n] {
+				t.Errorf("%s: frame %d = %d bytes; want %d", fl.name, n, len(s.Text()), len(payloads[n]))
+			}
+		}
+		if n != len(payloads) || s.Err() != nil {
+			t.Errorf("%s: read %d frames, %v; want %d, nil", fl.name, n, s.Err(), len(payloads))
+		}
+	}
+}
+
+func TestScanFramesTruncated(t *testing.T) {
+	for _, fl := range frameLengths {
+		// Every prefix for 200 is at least two bytes long, so the cuts
+		// land inside the prefix, just after it, and inside the payload.
+		whole := frame(fl.h, strings.Repeat("p", 200))
+		for _, cut := range []int{1, len(whole) - 200, len(whole) - 1} {
+			in := frame(fl.h, "ok") + whole[:cut]
+			scanAll(t, fl.name, in, ScanFrames(fl.h), []string{"ok"}, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestScanFramesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		h    FrameLength
+		in   string
+		err  error
+	}{
+		{"11-byte uvarint", FrameUvarint, strings.Repeat("\xff", 11), ErrFrameLength},
+		{"uvarint over 64 bits", FrameUvarint, strings.Repeat("\xff", 9) + "\x02", ErrFrameLength},
+		{"uvarint of 2^64-1", FrameUvarint, strings.Repeat("\xff", 9) + "\x01", ErrTooLong},
+		{"unknown FrameLength", FrameLength(99), "\x00\x00", ErrFrameLength},
+		// a valid length beyond the default maximum token size
+		{"4 GiB frame", FrameUint32BE, "\xff\xff\xff\xff" + strings.Repeat("x", 70000), ErrTooLong},
+	}
+	for _, tt := range tests {
+		scanAll(t, tt.name, tt.in, ScanFrames(tt.h), nil, tt.err)
+	}
+}
+
+func TestScanBuffer(t *testing.T) {
+	line := strings.Repeat("x", 500)
+	in := line + "\n" + line + line + "\nend"
+
+	// a small buffer grows up to max
+	s := NewScanner(iotest.OneByteReader(strings.NewReader(in)))
+	s.Buffer(make([]byte, 16), 1024)
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Text())
+	}
+	if len(got) != 3 || got[0] != line || got[1] != line+line || got[2] != "end" || s.Err() != nil {
+		t.Errorf("growing Buffer: %d tokens, %v", len(got), s.Err())
+	}
+
+	// but no further
+	s = NewScanner(strings.NewReader(in))
+	s.Buffer(make([]byte, 16), 600)
+	if !s.Scan() || s.Text() != line {
+		t.Fatalf("first line: %v", s.Err())
+	}
+	if s.Scan() || s.Err() != ErrTooLong {
+		t.Errorf("line longer than max: Scan ended with %v; want ErrTooLong", s.Err())
+	}
+
+	// with max <= cap(buf) the Scanner uses buf only
+	buf := make([]byte, 1024)
+	s = NewScanner(strings.NewReader(in))
+	s.Buffer(buf, 0)
+	if !s.Scan() || &s.Bytes()[0] != &buf[0] {
+		t.Errorf("token not in the buffer given to Buffer")
+	}
+	if !s.Scan() || len(s.Bytes()) != 1000 {
+		t.Fatalf("second token: %d bytes, %v", len(s.Bytes()), s.Err())
+	}
+	s.Bytes()[0] = 'Q'
+	if !strings.Contains(string(buf), "Q") {
+		t.Errorf("second token not in the buffer given to Buffer")
+	}
+}
+
+func TestScanMaxTokenSize(t *testing.T) {
+	fits := strings.Repeat("x", MaxScanTokenSize-1)
+	s := NewScanner(strings.NewReader(fits + "\n"))
+	if !s.Scan() || len(s.Bytes()) != len(fits) {
+		t.Errorf("token of MaxScanTokenSize-1 bytes: %v", s.Err())
+	}
+	s = NewScanner(strings.NewReader(fits + "x\n"))
+	if s.Scan() || s.Err() != ErrTooLong {
+		t.Errorf("token of MaxScanTokenSize bytes: Scan ended with %v; want ErrTooLong", s.Err())
+	}
+}
+
+func TestScanSplitErrors(t *testing.T) {
+	errSplit := errors.New("split failed")
+	tests := []struct {
+		name  string
+		split SplitFunc
+		want  []string
+		err   error
+	}{
+		{"error", func([]byte, bool) (int, []byte, error) { return 0, nil, errSplit }, nil, errSplit},
+		{"negative advance", func([]byte, bool) (int, []byte, error) { return -1, nil, nil }, nil, ErrNegativeAdvance},
+		{"advance too far", func(data []byte, _ bool) (int, []byte, error) { return len(data) + 1, nil, nil }, nil, ErrAdvanceTooFar},
+		{"final token", func(data []byte, _ bool) (int, []byte, error) { return 1, data[:1], ErrFinalToken }, []string{"a"}, nil},
+	}
+	for _, tt := range tests {
+		scanAll(t, tt.name, "abc", tt.split, tt.want, tt.err)
+	}
+}
+
+func TestScanReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	s := NewScanner(io.MultiReader(strings.NewReader("a\nb"), iotest.ErrReader(errRead)))
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Text())
+	}
+	// the partial line before the error is still returned
+	if strings.Join(got, "|") != "a|b" || s.Err() != errRead {
+		t.Errorf("got %q, %v; want [a b], %v", got, s.Err(), errRead)
+	}
+}
+
+func TestScanAfterScan(t *testing.T) {
+	for name, f := range map[string]func(*Scanner){
+		"Buffer": func(s *Scanner) { s.Buffer(nil, 10) },
+		"Split":  func(s *Scanner) { s.Split(ScanWords) },
+	} {
+		s := NewScanner(strings.NewReader("a"))
+		s.Scan()
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s after Scan did not panic", name)
+				}
+			}()
+			f(s)
+		}()
+	}
+}
@@ -9,6 +9,7 @@ package bytes
 import (
 	"errors"
 	"io"
+	"strconv"
 	"unicode/utf8"
 )
 
@@ -101,6 +102,17 @@ func (b *Buffer) Reset() {
 	b.lastRead = opInvalid
 }
 
+// Release empties the buffer and gives its underlying storage back to
+// the shared slice pool (see GetSlice), from which the buffer borrows
+// when it next has to grow. Slices returned by earlier calls to Bytes
+// or Next must not be used after Release.
+func (b *Buffer) Release() {
+	PutSlice(b.buf)
+	b.buf = nil
+	b.off = 0
+	b.lastRead = opInvalid
+}
+
 // tryGrowByReslice is a inlineable version of grow for the fast-case where the
 // internal buffer only needs to be resliced.
 // It returns the index where bytes should be written and whether it succeeded.
@@ -119,6 +131,7 @@ func (b *Buffer) tryGrowByReslice(n int) (int, bool) {
 
 // grow grows the buffer to guarantee space for n more bytes.
 // It returns the index where bytes should be written.
+// A slice it replaces goes back to the shared slice pool.
 // If the buffer can't grow it will panic with ErrTooLarge.
 func (b *Buffer) grow(n int) int {
 	m := b.Len() // 还有 m 这么多的数据没有被读取
@@ -148,6 +161,7 @@ func (b *Buffer) grow(n int) int {
 		// Not enough space anywhere, we need to allocate.
 		buf := makeSlice(2*c + n)
 		copy(buf, b.buf[b.off:])
+		PutSlice(b.buf)
 		b.buf = buf
 	}
 	// Restore b.off and len(b.buf).
@@ -228,7 +242,8 @@ func (b *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 }
 
-// makeSlice allocates a slice of size n. If the allocation fails, it panics
+// makeSlice allocates a slice of size n, borrowing it from the shared
+// slice pool if n fits a size class. If the allocation fails, it panics
 // with ErrTooLarge.
 func makeSlice(n int) []byte {
 	// If the make fails, give a known error.
@@ -238,7 +253,7 @@ func makeSlice(n int) []byte {
 			panic(ErrTooLarge)
 		}
 	}()
-	return make([]byte, n)
+	return GetSlice(n)
 }
 
 // WriteTo writes data to w until the buffer is drained or an error occurs.
@@ -443,6 +458,97 @@ func (b *Buffer) readSlice(delim byte) (line []byte, err error) {
 	return line, err
 }
 
+// A TokenTooLongError is returned by ReadBytesLimit and ReadSliceFunc
+// when the unread data is not empty, holds at least Max bytes and has
+// no delimiter within them.
+type TokenTooLongError struct {
+	Max int // the limit that was exceeded
+}
+
+func (e *TokenTooLongError) Error() string {
+	return "bytes.Buffer: token too long: no delimiter within " + strconv.Itoa(e.Max) + " bytes"
+}
+
+// ReadBytesLimit is like ReadBytes, but looks for delim only within the
+// first max unread bytes, so that a stream without delimiters cannot
+// make a reader hold on to an unbounded line. If delim is not among
+// them and at least max bytes are unread, it returns a
+// *TokenTooLongError and consumes nothing; the caller decides whether
+// to drop the data, for instance with Next, or the connection.
+// An empty buffer returns io.EOF whatever max is.
+// If max is negative, ReadBytesLimit will panic.
+// 防御恶意数据流：没有分隔符时 ReadBytes 会一直攒数据
+func (b *Buffer) ReadBytesLimit(delim byte, max int) (line []byte, err error) {
+	if max < 0 {
+		panic("bytes.Buffer.ReadBytesLimit: negative limit")
+	}
+	data := b.buf[b.off:]
+	if len(data) > max {
+		data = data[:max]
+	}
+	slice, err := b.readSliceIndex(IndexByte(data, delim), max)
+	// return a copy of slice. The buffer's backing array may
+	// be overwritten by later calls.
+	line = append(line, slice...)
+	return line, err
+}
+
+// ReadSliceFunc reads until the first byte c for which f(c) is true,
+// looking only within the first max unread bytes, and returns a slice
+// pointing at the bytes up to and including it. The slice is only
+// valid until the next buffer modification. If no byte satisfies f,
+// ReadSliceFunc returns a *TokenTooLongError, consuming nothing, when
+// at least max bytes are unread, or else the remaining data and io.EOF.
+// An empty buffer returns io.EOF whatever max is.
+// If max is negative, ReadSliceFunc will panic.
+func (b *Buffer) ReadSliceFunc(f func(c byte) bool, max int) (line []byte, err error) {
+	if max < 0 {
+		panic("bytes.Buffer.ReadSliceFunc: negative limit")
+	}
+	data := b.buf[b.off:]
+	if len(data) > max {
+		data = data[:max]
+	}
+	i := -1
+	for j, c := range data {
+		if f(c) {
+			i = j
+			break
+		}
+	}
+	return b.readSliceIndex(i, max)
+}
+
+// readSliceIndex consumes the unread data up to and including index i,
+// which was looked for within the first max bytes; i < 0 means it was
+// not found.
+func (b *Buffer) readSliceIndex(i, max int) (line []byte, err error) {
+	if i < 0 && !b.empty() && b.Len() >= max {
+		b.lastRead = opInvalid
+		return nil, &TokenTooLongError{Max: max}
+	}
+	end := b.off + i + 1
+	if i < 0 {
+		end = len(b.buf)
+		err = io.EOF
+	}
+	line = b.buf[b.off:end]
+	b.off = end
+	b.lastRead = opRead
+	return line, err
+}
+
+// IndexByte returns the index of the first instance of c in the unread
+// portion of the buffer, or -1 if c is not present. It does not consume
+// anything, so protocol code can check that a complete frame has
+// arrived before reading it.
+func (b *Buffer) IndexByte(c byte) int { return IndexByte(b.buf[b.off:], c) }
+
+// Index returns the index of the first instance of sep in the unread
+// portion of the buffer, or -1 if sep is not present. Like IndexByte,
+// it does not consume anything.
+func (b *Buffer) Index(sep []byte) int { return Index(b.buf[b.off:], sep) }
+
 // ReadString reads until the first occurrence of delim in the input,
 // returning a string containing the data up to and including the delimiter.
 // If ReadString encounters an error before finding a delimiter,
@@ -0,0 +1,163 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes_test
+
+import (
+	. "bytes"
+	"io"
+	"testing"
+)
+
+var readBytesLimitTests = []struct {
+	buffer   string
+	delim    byte
+	max      int
+	expected string
+	err      error
+	unread   string
+}{
+	{"", 0, 4, "", io.EOF, ""},
+	{"", 0, 0, "", io.EOF, ""},
+	{"", '\n', 0, "", io.EOF, ""},
+	{"ab\ncd", '\n', 4, "ab\n", nil, "cd"},
+	{"ab\ncd", '\n', 3, "ab\n", nil, "cd"},
+	{"ab\ncd", '\n', 2, "", &TokenTooLongError{Max: 2}, "ab\ncd"},
+	{"abcd", '\n', 4, "", &TokenTooLongError{Max: 4}, "abcd"},
+	{"abc", '\n', 4, "abc", io.EOF, ""},
+	{"abc", '\n', 0, "", &TokenTooLongError{Max: 0}, "abc"},
+}
+
+func sameError(a, b error) bool {
+	if ea, ok := a.(*TokenTooLongError); ok {
+		eb, ok := b.(*TokenTooLongError)
+		return ok && *ea == *eb
+	}
+	return a == b
+}
+
+func TestReadBytesLimit(t *testing.T) {
+	for _, test := range readBytesLimitTests {
+		buf := NewBufferString(test.buffer)
+		bytes, err := buf.ReadBytesLimit(test.delim, test.max)
+		if string(bytes) != test.expected || !sameError(err, test.err) {
+			t.Errorf("ReadBytesLimit(%q, %q, %d) = %q, %v; want %q, %v", test.buffer, test.delim, test.max, bytes, err, test.expected, test.err)
+		}
+		if buf.String() != test.unread {
+			t.Errorf("ReadBytesLimit(%q, %q, %d) left %q; want %q", test.buffer, test.delim, test.max, buf.String(), test.unread)
+		}
+	}
+}
+
+func TestReadSliceFunc(t *testing.T) {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	for _, test := range readBytesLimitTests {
+		buf := NewBufferString(test.buffer)
+		bytes, err := buf.ReadSliceFunc(func(c byte) bool { return c == test.delim }, test.max)
+		if string(bytes) != test.expected || !sameError(err, test.err) {
+			t.Errorf("ReadSliceFunc(%q, %q, %d) = %q, %v; want %q, %v", test.buffer, test.delim, test.max, bytes, err, test.expected, test.err)
+		}
+		if buf.String() != test.unread {
+			t.Errorf("ReadSliceFunc(%q, %q, %d) left %q; want %q", test.buffer, test.delim, test.max, buf.String(), test.unread)
+		}
+	}
+
+	buf := NewBufferString("key=42;")
+	if line, err := buf.ReadSliceFunc(isDigit, 10); string(line) != "key=4" || err != nil {
+		t.Errorf("ReadSliceFunc(isDigit) = %q, %v; want %q, nil", line, err, "key=4")
+	}
+	if err := buf.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte after ReadSliceFunc: %v", err)
+	}
+	if s := buf.String(); s != "42;" {
+		t.Errorf("after UnreadByte: %q; want %q", s, "42;")
+	}
+}
+
+func TestReadLimitNegative(t *testing.T) {
+	for _, read := range []func(*Buffer){
+		func(b *Buffer) { b.ReadBytesLimit('\n', -1) },
+		func(b *Buffer) { b.ReadSliceFunc(func(byte) bool { return true }, -1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("negative limit did not panic")
+				}
+			}()
+			read(NewBufferString("a\nb"))
+		}()
+	}
+}
+
+func TestTokenTooLongError(t *testing.T) {
+	_, err := NewBufferString("abcdef").ReadBytesLimit('\n', 5)
+	want := "bytes.Buffer: token too long: no delimiter within 5 bytes"
+	if err == nil || err.Error() != want {
+		t.Errorf("ReadBytesLimit error = %v; want %q", err, want)
+	}
+}
+
+func TestBufferIndex(t *testing.T) {
+	var buf Buffer
+	buf.WriteString("xxhello\r\nworld")
+	buf.Next(2)
+	if i := buf.IndexByte('\n'); i != 6 {
+		t.Errorf("IndexByte('\\n') = %d; want 6", i)
+	}
+	if i := buf.Index([]byte("\r\n")); i != 5 {
+		t.Errorf("Index(CRLF) = %d; want 5", i)
+	}
+	if i := buf.IndexByte('x'); i != -1 {
+		t.Errorf("IndexByte('x') = %d; want -1", i)
+	}
+	if buf.Len() != 12 {
+		t.Errorf("Index consumed data: Len = %d; want 12", buf.Len())
+	}
+}
+
+func TestBufferRelease(t *testing.T) {
+	var b Buffer
+	b.Write(make([]byte, 1000))
+	if b.Cap() != 1024 {
+		t.Fatalf("Cap() = %d; want the 1024-byte size class", b.Cap())
+	}
+	puts := poolStat(t, 1024).Puts
+	b.Release()
+	if b.Len() != 0 || b.Cap() != 0 {
+		t.Errorf("after Release: Len %d, Cap %d; want 0, 0", b.Len(), b.Cap())
+	}
+	if got := poolStat(t, 1024).Puts; got != puts+1 {
+		t.Errorf("Release put %d slices; want 1", got-puts)
+	}
+
+	// a released Buffer is usable again, with or without Reset
+	b.WriteString("hello")
+	b.Release()
+	b.Reset()
+	b.WriteString("world")
+	if s := b.String(); s != "world" {
+		t.Errorf("after Release and Reset: %q; want %q", s, "world")
+	}
+	var z Buffer
+	z.Release() // nothing to give back
+	z.Reset()
+	if z.Len() != 0 {
+		t.Errorf("zero Buffer after Release: Len %d", z.Len())
+	}
+}
+
+func TestBufferGrowPutsSlice(t *testing.T) {
+	var b Buffer
+	b.Write(make([]byte, 1000))
+	b.Next(10)
+	puts := poolStat(t, 1024).Puts
+	b.Write(make([]byte, 2000)) // moves the data to a larger slice
+	if b.Len() != 2990 {
+		t.Fatalf("Len() = %d; want 2990", b.Len())
+	}
+	if got := poolStat(t, 1024).Puts; got != puts+1 {
+		t.Errorf("grow put %d slices of 1024 bytes back; want 1", got-puts)
+	}
+}
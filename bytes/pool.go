@@ -0,0 +1,104 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Size classes of the shared slice pool: powers of two from
+// 1<<minPoolShift to 1<<maxPoolShift bytes.
+const (
+	minPoolShift = 9  // 512 B
+	maxPoolShift = 16 // 64 KiB
+	numPoolClass = maxPoolShift - minPoolShift + 1
+)
+
+// slicePools holds *[]byte of capacity exactly 1<<(minPoolShift+i).
+// The counters are kept apart from the pools so that they stay 64-bit
+// aligned for the atomic operations on 32-bit platforms.
+// 之前 net/http、bufio 各自维护 sync.Pool，同样大小的 buffer 互相不能复用
+var (
+	slicePools [numPoolClass]sync.Pool
+	poolHits   [numPoolClass]uint64
+	poolMisses [numPoolClass]uint64
+	poolPuts   [numPoolClass]uint64
+)
+
+// poolClass returns the index of the smallest size class holding n
+// bytes, or -1 if n is larger than the largest class.
+func poolClass(n int) int {
+	if n <= 1<<minPoolShift {
+		return 0
+	}
+	if n > 1<<maxPoolShift {
+		return -1
+	}
+	return bits.Len(uint(n-1)) - minPoolShift
+}
+
+// GetSlice returns a slice of length n from the shared, size-classed
+// slice pool. Its capacity is n rounded up to the next size class and
+// its contents are arbitrary. Sizes beyond the largest class, 64 KiB,
+// are allocated directly.
+//
+// The slice pool is shared by bytes.Buffer, bufio.Reader and
+// bufio.Writer; see their Release methods.
+func GetSlice(n int) []byte {
+	if n < 0 {
+		panic("bytes.GetSlice: negative size")
+	}
+	c := poolClass(n)
+	if c < 0 {
+		return make([]byte, n)
+	}
+	if p, _ := slicePools[c].Get().(*[]byte); p != nil {
+		atomic.AddUint64(&poolHits[c], 1)
+		return (*p)[:n]
+	}
+	atomic.AddUint64(&poolMisses[c], 1)
+	return make([]byte, n, 1<<(minPoolShift+c))
+}
+
+// PutSlice returns b to the shared slice pool for reuse by GetSlice.
+// Slices whose capacity is not exactly a size class are left to the
+// garbage collector. The caller must not use b, or any slice sharing
+// its memory, afterwards.
+func PutSlice(b []byte) {
+	c := poolClass(cap(b))
+	if c < 0 || cap(b) != 1<<(minPoolShift+c) {
+		return
+	}
+	atomic.AddUint64(&poolPuts[c], 1)
+	b = b[:cap(b)]
+	slicePools[c].Put(&b)
+}
+
+// A PoolStat holds the counters of one size class of the shared slice
+// pool. A high Misses to Hits ratio means slices are not being given
+// back, or are being dropped by the garbage collector between uses.
+type PoolStat struct {
+	Size   int    // capacity of the slices in this class
+	Hits   uint64 // GetSlice calls served from the pool
+	Misses uint64 // GetSlice calls that had to allocate
+	Puts   uint64 // slices given back by PutSlice
+}
+
+// PoolStats returns the counters of each size class of the shared slice
+// pool, smallest class first.
+func PoolStats() []PoolStat {
+	stats := make([]PoolStat, numPoolClass)
+	for i := range stats {
+		stats[i] = PoolStat{
+			Size:   1 << (minPoolShift + i),
+			Hits:   atomic.LoadUint64(&poolHits[i]),
+			Misses: atomic.LoadUint64(&poolMisses[i]),
+			Puts:   atomic.LoadUint64(&poolPuts[i]),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,116 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes_test
+
+import (
+	. "bytes"
+	"testing"
+)
+
+// poolStat returns the counters of the size class of the given size.
+func poolStat(t *testing.T, size int) PoolStat {
+	t.Helper()
+	for _, s := range PoolStats() {
+		if s.Size == size {
+			return s
+		}
+	}
+	t.Fatalf("no size class of %d bytes", size)
+	return PoolStat{}
+}
+
+func TestPoolStats(t *testing.T) {
+	stats := PoolStats()
+	if len(stats) != 8 || stats[0].Size != 512 || stats[7].Size != 64<<10 {
+		t.Fatalf("PoolStats() = %+v; want classes from 512 B to 64 KiB", stats)
+	}
+	for i := 1; i < len(stats); i++ {
+		if stats[i].Size != 2*stats[i-1].Size {
+			t.Errorf("class %d is %d bytes after %d", i, stats[i].Size, stats[i-1].Size)
+		}
+	}
+}
+
+func TestGetSlice(t *testing.T) {
+	tests := []struct {
+		n, cap int
+	}{
+		{0, 512},
+		{1, 512},
+		{512, 512},
+		{513, 1024},
+		{4000, 4096},
+		{64 << 10, 64 << 10},
+		{64<<10 + 1, 64<<10 + 1}, // beyond the largest class
+	}
+	for _, tt := range tests {
+		class, want := tt.cap, uint64(1)
+		if class > 64<<10 {
+			class, want = 64<<10, 0 // allocated directly, not counted
+		}
+		before := poolStat(t, class)
+		b := GetSlice(tt.n)
+		if len(b) != tt.n || cap(b) != tt.cap {
+			t.Errorf("GetSlice(%d): len %d, cap %d; want %d, %d", tt.n, len(b), cap(b), tt.n, tt.cap)
+		}
+		after := poolStat(t, class)
+		if gets := after.Hits + after.Misses - before.Hits - before.Misses; gets != want {
+			t.Errorf("GetSlice(%d) counted %d gets in class %d; want %d", tt.n, gets, class, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("GetSlice(-1) did not panic")
+		}
+	}()
+	GetSlice(-1)
+}
+
+func TestPutSlice(t *testing.T) {
+	tests := []struct {
+		b     []byte
+		class int // class counting the Put, 0 if none
+	}{
+		{make([]byte, 2048), 2048},
+		{make([]byte, 10, 2048), 2048}, // the length does not matter
+		{make([]byte, 1000), 0},        // not a class size
+		{make([]byte, 100), 0},         // smaller than the smallest class
+		{make([]byte, 128<<10), 0},     // larger than the largest class
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		before := PoolStats()
+		PutSlice(tt.b)
+		after := PoolStats()
+		for i := range after {
+			want := before[i].Puts
+			if after[i].Size == tt.class {
+				want++
+			}
+			if after[i].Puts != want {
+				t.Errorf("PutSlice(cap %d): class %d counted %d puts", cap(tt.b), after[i].Size, after[i].Puts-before[i].Puts)
+			}
+		}
+	}
+}
+
+func TestPoolReuse(t *testing.T) {
+	b := GetSlice(8 << 10)
+	before := poolStat(t, 8<<10)
+	PutSlice(b)
+	c := GetSlice(8 << 10)
+	after := poolStat(t, 8<<10)
+	if after.Puts != before.Puts+1 {
+		t.Errorf("Puts went from %d to %d; want one more", before.Puts, after.Puts)
+	}
+	// sync.Pool may drop what it is given, so a miss is allowed
+	if after.Hits+after.Misses != before.Hits+before.Misses+1 {
+		t.Errorf("GetSlice after PutSlice counted %d hits and %d misses", after.Hits-before.Hits, after.Misses-before.Misses)
+	}
+	if len(c) != 8<<10 || cap(c) != 8<<10 {
+		t.Errorf("GetSlice after PutSlice: len %d, cap %d", len(c), cap(c))
+	}
+}
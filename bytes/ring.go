@@ -0,0 +1,401 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrRingFull is returned by writes to a non-blocking Ring that has no
+// room left for the data.
+var ErrRingFull = errors.New("bytes.Ring: ring is full")
+
+var errRingUnreadByte = errors.New("bytes.Ring: UnreadByte: previous operation was not a successful read")
+
+// A Ring is a fixed-capacity circular buffer of bytes with the Read and
+// Write methods of a Buffer. Unlike a Buffer it never moves or
+// reallocates its data: reads and writes wrap around the end of the
+// storage, and Peek returns the unread bytes as up to two slices.
+//
+// By default a Ring does not block: a write that does not fit fails with
+// ErrRingFull and a read of an empty Ring returns io.EOF. With
+// SetBlocking(true) it works as a bounded pipe between goroutines:
+// writes wait for room and reads wait for data until Close is called.
+//
+// A Ring is safe for concurrent use. Concurrent readers, and concurrent
+// writers, are serialized among themselves, while a reader and a writer
+// copy their data at the same time.
+// Buffer.grow 在长期的流式读写中会不断地 copy 滑动数据，Ring 则只移动读写下标
+type Ring struct {
+	rmu sync.Mutex // serializes readers
+	wmu sync.Mutex // serializes writers
+
+	mu        sync.Mutex // guards the fields below
+	readable  sync.Cond  // signaled when data is committed or the ring is closed
+	writable  sync.Cond  // signaled when space is freed or the ring is closed
+	buf       []byte
+	r         int  // read position
+	n         int  // number of unread bytes
+	canUnread bool // last read may be undone; no writer has claimed its space since
+	blocking  bool
+	closed    bool
+}
+
+// NewRing returns a non-blocking Ring holding at most size bytes.
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		panic("bytes.NewRing: non-positive size")
+	}
+	b := &Ring{buf: make([]byte, size)}
+	b.readable.L = &b.mu
+	b.writable.L = &b.mu
+	return b
+}
+
+// SetBlocking sets whether reads of an empty Ring and writes to a full
+// Ring wait rather than fail.
+func (b *Ring) SetBlocking(on bool) {
+	b.mu.Lock()
+	b.blocking = on
+	b.readable.Broadcast()
+	b.writable.Broadcast()
+	b.mu.Unlock()
+}
+
+// Close closes the writing side of the Ring. Readers get the data still
+// buffered and then io.EOF; writes fail with io.ErrClosedPipe. Blocked
+// readers and writers are woken up.
+func (b *Ring) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.readable.Broadcast()
+	b.writable.Broadcast()
+	b.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of unread bytes.
+func (b *Ring) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
+
+// Cap returns the capacity of the Ring.
+func (b *Ring) Cap() int { return len(b.buf) }
+
+// Available returns how many bytes can be written without blocking.
+func (b *Ring) Available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.buf) - b.n
+}
+
+// Reset discards all unread data. It does not reopen a closed Ring.
+// Reset must not be called concurrently with reads or writes.
+func (b *Ring) Reset() {
+	b.mu.Lock()
+	b.r = 0
+	b.n = 0
+	b.canUnread = false
+	b.writable.Broadcast()
+	b.mu.Unlock()
+}
+
+// span returns the bytes of buf starting at off, length n, wrapping
+// around the end, as up to two slices.
+func (b *Ring) span(off, n int) (first, second []byte) {
+	if off >= len(b.buf) {
+		off -= len(b.buf)
+	}
+	if end := off + n; end <= len(b.buf) {
+		return b.buf[off:end], nil
+	}
+	return b.buf[off:], b.buf[:n-(len(b.buf)-off)]
+}
+
+// Peek returns, without consuming them, up to n of the unread bytes as
+// two slices; second is non-empty only if the data wraps around the end
+// of the Ring. The slices are valid until the next read. Peek never
+// blocks. If n is negative, Peek will panic.
+func (b *Ring) Peek(n int) (first, second []byte) {
+	if n < 0 {
+		panic("bytes.Ring.Peek: negative count")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.n {
+		n = b.n
+	}
+	return b.span(b.r, n)
+}
+
+// waitData waits until the Ring holds data. It returns the number of
+// unread bytes, or 0 if the Ring is empty and not blocking or closed.
+// It must be called with b.mu held.
+func (b *Ring) waitData() int {
+	for b.n == 0 && b.blocking && !b.closed {
+		b.readable.Wait()
+	}
+	return b.n
+}
+
+// waitSpace waits until the Ring has room for data. It returns the
+// number of free bytes, or 0 if the Ring is full and not blocking,
+// and an error if the Ring is closed.
+// It must be called with b.mu held.
+func (b *Ring) waitSpace() (int, error) {
+	for b.n == len(b.buf) && b.blocking && !b.closed {
+		b.writable.Wait()
+	}
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	// the space is claimed by the writer: an earlier read can no longer be undone
+	b.canUnread = false
+	return len(b.buf) - b.n, nil
+}
+
+// consume marks n bytes as read.
+// It must be called with b.mu held.
+func (b *Ring) consume(n int) {
+	b.r = (b.r + n) % len(b.buf)
+	b.n -= n
+	b.canUnread = n > 0
+	b.writable.Broadcast()
+}
+
+// commit marks n bytes written after the unread data as readable.
+// It must be called with b.mu held.
+func (b *Ring) commit(n int) {
+	b.n += n
+	b.readable.Broadcast()
+}
+
+// Read reads the next len(p) bytes from the Ring or until the Ring is
+// drained. The return value n is the number of bytes read. If the Ring
+// has no data to return, err is io.EOF (unless len(p) is zero); a
+// blocking Ring first waits for data until it is closed.
+func (b *Ring) Read(p []byte) (n int, err error) {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	b.mu.Lock()
+	avail := b.waitData()
+	first, second := b.span(b.r, avail)
+	b.mu.Unlock()
+	if avail == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	// copy without b.mu: writers do not touch unread bytes
+	n = copy(p, first)
+	n += copy(p[n:], second)
+	b.mu.Lock()
+	b.consume(n)
+	b.mu.Unlock()
+	return n, nil
+}
+
+// ReadByte reads and returns the next byte from the Ring.
+// If no byte is available, it returns error io.EOF.
+func (b *Ring) ReadByte() (byte, error) {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.waitData() == 0 {
+		return 0, io.EOF
+	}
+	c := b.buf[b.r]
+	b.consume(1)
+	return c, nil
+}
+
+// UnreadByte unreads the last byte returned by the most recent
+// successful read operation that read at least one byte. If a write
+// has happened since the last read, or if the last read returned an
+// error, UnreadByte returns an error.
+func (b *Ring) UnreadByte() error {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.canUnread {
+		return errRingUnreadByte
+	}
+	b.canUnread = false
+	b.r = (b.r + len(b.buf) - 1) % len(b.buf)
+	b.n++
+	return nil
+}
+
+// Discard skips the next n unread bytes, or all of them if there are
+// fewer, without blocking. It returns the number of bytes discarded.
+func (b *Ring) Discard(n int) int {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.n {
+		n = b.n
+	}
+	if n > 0 {
+		b.consume(n)
+		b.canUnread = false
+	}
+	return n
+}
+
+// Write appends the contents of p to the Ring. A non-blocking Ring
+// writes what fits and returns ErrRingFull if that is not all of p;
+// a blocking Ring waits for room until all of p is written.
+// After Close, Write returns io.ErrClosedPipe.
+func (b *Ring) Write(p []byte) (n int, err error) {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	for len(p) > 0 {
+		b.mu.Lock()
+		free, err := b.waitSpace()
+		if err != nil || free == 0 {
+			b.mu.Unlock()
+			if err == nil {
+				err = ErrRingFull
+			}
+			return n, err
+		}
+		first, second := b.span(b.r+b.n, free)
+		b.mu.Unlock()
+		// copy without b.mu: readers do not touch free space
+		m := copy(first, p)
+		m += copy(second, p[m:])
+		b.mu.Lock()
+		b.commit(m)
+		b.mu.Unlock()
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// WriteString appends the contents of s to the Ring, like Write.
+func (b *Ring) WriteString(s string) (n int, err error) {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	for len(s) > 0 {
+		b.mu.Lock()
+		free, err := b.waitSpace()
+		if err != nil || free == 0 {
+			b.mu.Unlock()
+			if err == nil {
+				err = ErrRingFull
+			}
+			return n, err
+		}
+		first, second := b.span(b.r+b.n, free)
+		b.mu.Unlock()
+		m := copy(first, s)
+		m += copy(second, s[m:])
+		b.mu.Lock()
+		b.commit(m)
+		b.mu.Unlock()
+		n += m
+		s = s[m:]
+	}
+	return n, nil
+}
+
+// WriteByte appends the byte c to the Ring, like Write.
+func (b *Ring) WriteByte(c byte) error {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	free, err := b.waitSpace()
+	if err != nil {
+		return err
+	}
+	if free == 0 {
+		return ErrRingFull
+	}
+	b.buf[(b.r+b.n)%len(b.buf)] = c
+	b.commit(1)
+	return nil
+}
+
+// ReadFrom reads data from r until EOF and appends it to the Ring,
+// reading directly into the free space. The return value n is the
+// number of bytes read. Any error except io.EOF encountered during the
+// read is also returned. A non-blocking Ring stops with ErrRingFull
+// when it fills up before r is exhausted.
+func (b *Ring) ReadFrom(r io.Reader) (n int64, err error) {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	for {
+		b.mu.Lock()
+		free, err := b.waitSpace()
+		if err != nil || free == 0 {
+			b.mu.Unlock()
+			if err == nil {
+				err = ErrRingFull
+			}
+			return n, err
+		}
+		first, _ := b.span(b.r+b.n, free)
+		b.mu.Unlock()
+		m, e := r.Read(first) // may block; only the free space is in use
+		if m < 0 {
+			panic(errNegativeRead)
+		}
+		b.mu.Lock()
+		b.commit(m)
+		b.mu.Unlock()
+		n += int64(m)
+		if e == io.EOF {
+			return n, nil // e is EOF, so return nil explicitly
+		}
+		if e != nil {
+			return n, e
+		}
+	}
+}
+
+// WriteTo writes data to w until the Ring is drained or an error occurs.
+// The return value n is the number of bytes written. A blocking Ring
+// keeps waiting for data until it is closed. Any error encountered
+// during the write is also returned.
+func (b *Ring) WriteTo(w io.Writer) (n int64, err error) {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	for {
+		b.mu.Lock()
+		avail := b.waitData()
+		first, _ := b.span(b.r, avail)
+		b.mu.Unlock()
+		if avail == 0 {
+			return n, nil
+		}
+		m, e := w.Write(first)
+		if m > len(first) {
+			panic("bytes.Ring.WriteTo: invalid Write count")
+		}
+		b.mu.Lock()
+		b.consume(m)
+		b.canUnread = false
+		b.mu.Unlock()
+		n += int64(m)
+		if e != nil {
+			return n, e
+		}
+		// all bytes should have been written, by definition of
+		// Write method in io.Writer
+		if m != len(first) {
+			return n, io.ErrShortWrite
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes_test
+
+import (
+	. "bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRingNonBlocking(t *testing.T) {
+	r := NewRing(8)
+	if n, err := r.WriteString("abcdefghij"); n != 8 || err != ErrRingFull {
+		t.Fatalf("WriteString into Ring(8) = %d, %v; want 8, ErrRingFull", n, err)
+	}
+	if err := r.WriteByte('x'); err != ErrRingFull {
+		t.Errorf("WriteByte into a full Ring = %v; want ErrRingFull", err)
+	}
+	p := make([]byte, 5)
+	if n, err := r.Read(p); n != 5 || err != nil || string(p) != "abcde" {
+		t.Fatalf("Read = %d, %v, %q; want 5, nil, %q", n, err, p[:n], "abcde")
+	}
+	if n := r.Discard(10); n != 3 {
+		t.Errorf("Discard(10) = %d; want 3", n)
+	}
+	if n, err := r.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("Read of an empty Ring = %d, %v; want 0, EOF", n, err)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte of an empty Ring = %v; want EOF", err)
+	}
+}
+
+func TestRingUnreadByteWrap(t *testing.T) {
+	r := NewRing(4)
+	r.WriteString("abc")
+	r.Discard(3)
+	// the read position is now at the last slot, so "wxyz" wraps
+	r.WriteString("wxyz")
+	if f, s := r.Peek(4); string(f) != "w" || string(s) != "xyz" {
+		t.Fatalf("Peek(4) = %q, %q; want %q, %q", f, s, "w", "xyz")
+	}
+	if c, err := r.ReadByte(); c != 'w' || err != nil {
+		t.Fatalf("ReadByte = %q, %v; want 'w', nil", c, err)
+	}
+	// unreading steps back across the end of the buffer
+	if err := r.UnreadByte(); err != nil {
+		t.Fatalf("UnreadByte after wrap: %v", err)
+	}
+	if err := r.UnreadByte(); err == nil {
+		t.Error("second UnreadByte succeeded")
+	}
+	p := make([]byte, 4)
+	if n, _ := r.Read(p); string(p[:n]) != "wxyz" {
+		t.Errorf("Read after UnreadByte = %q; want %q", p[:n], "wxyz")
+	}
+	if err := r.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte after Read: %v", err)
+	}
+	if c, _ := r.ReadByte(); c != 'z' {
+		t.Errorf("ReadByte after UnreadByte = %q; want 'z'", c)
+	}
+	r.WriteByte('a')
+	if err := r.UnreadByte(); err == nil {
+		t.Error("UnreadByte after a write succeeded")
+	}
+}
+
+func TestRingBlocking(t *testing.T) {
+	r := NewRing(5)
+	r.SetBlocking(true)
+	want := make([]byte, 10000)
+	for i := range want {
+		want[i] = byte(i % 251)
+	}
+	go func() {
+		for d := want; len(d) > 0; {
+			n := len(d)%13 + 1
+			if n > len(d) {
+				n = len(d)
+			}
+			if _, err := r.Write(d[:n]); err != nil {
+				t.Error(err)
+				return
+			}
+			d = d[n:]
+		}
+		r.Close()
+	}()
+	var got Buffer
+	if _, err := r.WriteTo(&got); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("blocking Ring delivered %d bytes, not the %d written", got.Len(), len(want))
+	}
+}
+
+func TestRingBlockedReadClose(t *testing.T) {
+	r := NewRing(4)
+	r.SetBlocking(true)
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Read of an empty blocking Ring returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.Close()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("blocked Read after Close = %v; want EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not wake the blocked Read")
+	}
+}
+
+func TestRingBlockedWriteClose(t *testing.T) {
+	r := NewRing(4)
+	r.SetBlocking(true)
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.WriteString("abcdef")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Write into a full blocking Ring returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.Close()
+	select {
+	case err := <-done:
+		if err != io.ErrClosedPipe {
+			t.Errorf("blocked Write after Close = %v; want ErrClosedPipe", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not wake the blocked Write")
+	}
+	// the bytes written before Close can still be read
+	p := make([]byte, 8)
+	if n, err := r.Read(p); string(p[:n]) != "abcd" || err != nil {
+		t.Errorf("Read after Close = %q, %v; want %q, nil", p[:n], err, "abcd")
+	}
+	if _, err := r.Read(p); err != io.EOF {
+		t.Errorf("Read of a drained closed Ring = %v; want EOF", err)
+	}
+	if err := r.WriteByte('x'); err != io.ErrClosedPipe {
+		t.Errorf("WriteByte after Close = %v; want ErrClosedPipe", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// ropeChunkSize is the size of the chunks of a Rope. It is a size class
+// of the shared slice pool, so that chunks are recycled through it.
+const ropeChunkSize = 16 << 10
+
+var errRopeNegativeOffset = errors.New("bytes.Rope.ReadAt: negative offset")
+
+// A Rope is a variable-sized buffer of bytes with Read and Write methods,
+// stored as a chain of fixed-size chunks instead of one contiguous slice.
+// Appending never copies the data already held, so a Rope can grow to
+// hundreds of megabytes without the 3x peak a Buffer pays when it doubles
+// its slice, and chunks that have been read are given back to the shared
+// slice pool (see GetSlice) right away.
+// The zero value for Rope is an empty rope ready to use.
+// Buffer 扩容时新旧两份 slice 同时存在，峰值内存是数据量的 3 倍；Rope 只追加 chunk
+type Rope struct {
+	// Every chunk but the last is full, so that an offset maps to its
+	// chunk by division. The unread data starts at chunks[0][off].
+	chunks [][]byte
+	off    int
+	n      int // number of unread bytes
+}
+
+// Len returns the number of bytes of the unread portion of the rope.
+func (b *Rope) Len() int { return b.n }
+
+// Reset resets the rope to be empty and gives all of its chunks back to
+// the slice pool. Slices returned by earlier reads must not be used.
+func (b *Rope) Reset() {
+	for i, c := range b.chunks {
+		PutSlice(c)
+		b.chunks[i] = nil
+	}
+	b.chunks = b.chunks[:0]
+	b.off = 0
+	b.n = 0
+}
+
+// tail returns the last chunk, first adding a new one if it is full.
+func (b *Rope) tail() []byte {
+	if k := len(b.chunks); k > 0 && len(b.chunks[k-1]) < ropeChunkSize {
+		return b.chunks[k-1]
+	}
+	c := GetSlice(ropeChunkSize)[:0]
+	b.chunks = append(b.chunks, c)
+	return c
+}
+
+// extend marks m more bytes of the last chunk as written.
+func (b *Rope) extend(m int) {
+	k := len(b.chunks) - 1
+	b.chunks[k] = b.chunks[k][:len(b.chunks[k])+m]
+	b.n += m
+}
+
+// advance consumes n unread bytes and gives the chunks read to the end
+// back to the pool. A partly written last chunk is kept and rewound
+// once it has been read completely.
+func (b *Rope) advance(n int) {
+	b.n -= n
+	n += b.off
+	for n >= ropeChunkSize {
+		PutSlice(b.chunks[0])
+		b.chunks[0] = nil
+		b.chunks = b.chunks[1:]
+		n -= ropeChunkSize
+	}
+	b.off = n
+	if b.n == 0 && len(b.chunks) > 0 {
+		b.chunks[0] = b.chunks[0][:0]
+		b.off = 0
+	}
+}
+
+// Write appends the contents of p to the rope. The return value n is
+// the length of p; err is always nil.
+func (b *Rope) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		t := b.tail()
+		m := copy(t[len(t):cap(t)], p)
+		b.extend(m)
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// WriteString appends the contents of s to the rope. The return value
+// n is the length of s; err is always nil.
+func (b *Rope) WriteString(s string) (n int, err error) {
+	for len(s) > 0 {
+		t := b.tail()
+		m := copy(t[len(t):cap(t)], s)
+		b.extend(m)
+		n += m
+		s = s[m:]
+	}
+	return n, nil
+}
+
+// WriteByte appends the byte c to the rope. The returned error is
+// always nil.
+func (b *Rope) WriteByte(c byte) error {
+	t := b.tail()
+	t = append(t, c) // within the chunk's capacity
+	b.chunks[len(b.chunks)-1] = t
+	b.n++
+	return nil
+}
+
+// ReadFrom reads data from r until EOF and appends it to the rope,
+// reading directly into its chunks. The return value n is the number of
+// bytes read. Any error except io.EOF encountered during the read is
+// also returned.
+func (b *Rope) ReadFrom(r io.Reader) (n int64, err error) {
+	for {
+		t := b.tail()
+		m, e := r.Read(t[len(t):cap(t)])
+		if m < 0 {
+			panic(errNegativeRead)
+		}
+		b.extend(m)
+		n += int64(m)
+		if e == io.EOF {
+			return n, nil // e is EOF, so return nil explicitly
+		}
+		if e != nil {
+			return n, e
+		}
+	}
+}
+
+// Read reads the next len(p) bytes from the rope or until the rope is
+// drained. The return value n is the number of bytes read. If the rope
+// has no data to return, err is io.EOF (unless len(p) is zero);
+// otherwise it is nil.
+func (b *Rope) Read(p []byte) (n int, err error) {
+	if b.n == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	for n < len(p) && b.n > 0 {
+		m := copy(p[n:], b.chunks[0][b.off:])
+		b.advance(m)
+		n += m
+	}
+	return n, nil
+}
+
+// ReadByte reads and returns the next byte from the rope.
+// If no byte is available, it returns error io.EOF.
+func (b *Rope) ReadByte() (byte, error) {
+	if b.n == 0 {
+		return 0, io.EOF
+	}
+	c := b.chunks[0][b.off]
+	b.advance(1)
+	return c, nil
+}
+
+// ReadAt reads len(p) bytes into p starting at offset off of the unread
+// portion of the rope, without consuming them. It implements io.ReaderAt:
+// if it reads fewer than len(p) bytes, err is io.EOF.
+func (b *Rope) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errRopeNegativeOffset
+	}
+	if off >= int64(b.n) {
+		return 0, io.EOF
+	}
+	pos := b.off + int(off)
+	for i, j := pos/ropeChunkSize, pos%ropeChunkSize; n < len(p) && i < len(b.chunks); i, j = i+1, 0 {
+		n += copy(p[n:], b.chunks[i][j:])
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// WriteTo writes data to w until the rope is drained or an error occurs.
+// The chunks are handed to w as one net.Buffers, which becomes a single
+// writev(2) on connections that support it. The return value n is the
+// number of bytes written. Any error encountered during the write is
+// also returned.
+func (b *Rope) WriteTo(w io.Writer) (n int64, err error) {
+	if b.n == 0 {
+		return 0, nil
+	}
+	bufs := make(net.Buffers, 0, len(b.chunks))
+	bufs = append(bufs, b.chunks[0][b.off:])
+	for _, c := range b.chunks[1:] {
+		if len(c) > 0 {
+			bufs = append(bufs, c)
+		}
+	}
+	total := b.n
+	n, err = bufs.WriteTo(w)
+	if n > int64(total) {
+		panic("bytes.Rope.WriteTo: invalid Write count")
+	}
+	b.advance(int(n))
+	if n < int64(total) && err == nil {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
@@ -0,0 +1,251 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes_test
+
+import (
+	. "bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+const chunk = 16 << 10 // size of the chunks of a Rope
+
+// ropeData returns n bytes of a pattern that does not repeat at chunk
+// boundaries, so that misplaced chunks are noticed.
+func ropeData(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i*7 + i/251)
+	}
+	return p
+}
+
+func TestRopeReadWrite(t *testing.T) {
+	data := ropeData(3*chunk + 100)
+	var r Rope
+	r.Write(data[:10])
+	r.WriteString(string(data[10 : chunk+5]))
+	for _, c := range data[chunk+5 : chunk+20] {
+		r.WriteByte(c)
+	}
+	if n, err := r.ReadFrom(NewBuffer(data[chunk+20:])); n != int64(len(data)-chunk-20) || err != nil {
+		t.Fatalf("ReadFrom = %d, %v; want %d, nil", n, err, len(data)-chunk-20)
+	}
+	if r.Len() != len(data) {
+		t.Fatalf("Len() = %d; want %d", r.Len(), len(data))
+	}
+
+	// reads of an odd size cross every chunk boundary at a different place
+	var got []byte
+	p := make([]byte, 7777)
+	for {
+		n, err := r.Read(p)
+		got = append(got, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || n == 0 {
+			t.Fatalf("Read = %d, %v", n, err)
+		}
+	}
+	if string(got) != string(data) {
+		t.Fatalf("read back %d bytes, differing from the %d written", len(got), len(data))
+	}
+	if n, err := r.Read(nil); n != 0 || err != nil {
+		t.Errorf("Read(nil) of an empty Rope = %d, %v; want 0, nil", n, err)
+	}
+
+	// the rope is usable again once drained
+	r.WriteString("again")
+	if n, err := r.Read(p); string(p[:n]) != "again" || err != nil {
+		t.Errorf("Read after refill = %q, %v; want %q, nil", p[:n], err, "again")
+	}
+}
+
+func TestRopeReadAt(t *testing.T) {
+	data := ropeData(2*chunk + 50)
+	var r Rope
+	r.Write(data)
+	tests := []struct {
+		off, len int
+		n        int
+		err      error
+	}{
+		{0, 100, 100, nil},
+		{chunk - 10, 20, 20, nil},              // across a chunk boundary
+		{chunk - 1, chunk + 2, chunk + 2, nil}, // across two boundaries
+		{chunk, 10, 10, nil},                   // at the start of a chunk
+		{len(data) - 5, 5, 5, nil},             // the last bytes
+		{len(data) - 5, 10, 5, io.EOF},         // reaching past the end
+		{len(data), 1, 0, io.EOF},              // at the end
+		{len(data) + 100, 1, 0, io.EOF},        // past the end
+		{10, 0, 0, nil},
+	}
+	check := func(base int) {
+		t.Helper()
+		for _, tt := range tests {
+			off, length := tt.off-base, tt.len
+			if off < 0 {
+				continue
+			}
+			p := make([]byte, length)
+			n, err := r.ReadAt(p, int64(off))
+			want := tt.n
+			if want > 0 && off+want > len(data)-base {
+				want = len(data) - base - off
+			}
+			if n != want || err != tt.err || n > 0 && string(p[:n]) != string(data[base+off:base+off+n]) {
+				t.Errorf("after %d bytes read: ReadAt(%d bytes, %d) = %d, %v; want %d, %v", base, length, off, n, err, want, tt.err)
+			}
+		}
+	}
+	check(0)
+	if r.Len() != len(data) {
+		t.Fatalf("ReadAt consumed data: Len() = %d", r.Len())
+	}
+
+	// offsets are relative to the unread portion
+	r.Read(make([]byte, 30))
+	check(30)
+
+	if _, err := r.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("ReadAt with a negative offset succeeded")
+	}
+}
+
+func TestRopeByte(t *testing.T) {
+	var r Rope
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte of an empty Rope = %v; want EOF", err)
+	}
+	// fill the first chunk but one byte, then write bytes across the boundary
+	r.Write(make([]byte, chunk-1))
+	for _, c := range []byte("xyz") {
+		if err := r.WriteByte(c); err != nil {
+			t.Fatalf("WriteByte: %v", err)
+		}
+	}
+	if r.Len() != chunk+2 {
+		t.Fatalf("Len() = %d; want %d", r.Len(), chunk+2)
+	}
+	r.Read(make([]byte, chunk-1))
+	for _, want := range []byte("xyz") {
+		if c, err := r.ReadByte(); c != want || err != nil {
+			t.Fatalf("ReadByte = %q, %v; want %q, nil", c, err, want)
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte of a drained Rope = %v; want EOF", err)
+	}
+}
+
+// failWriter accepts max bytes and then fails.
+type failWriter struct {
+	b   Buffer
+	max int
+}
+
+var errFail = errors.New("write failed")
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max-w.b.Len() {
+		n, _ := w.b.Write(p[:w.max-w.b.Len()])
+		return n, errFail
+	}
+	return w.b.Write(p)
+}
+
+func TestRopeWriteTo(t *testing.T) {
+	data := ropeData(3*chunk + 100)
+	var r Rope
+	r.Write(data)
+	r.Read(make([]byte, 100))
+
+	var out Buffer
+	if n, err := r.WriteTo(&out); n != 3*chunk || err != nil {
+		t.Fatalf("WriteTo = %d, %v; want %d, nil", n, err, 3*chunk)
+	}
+	if out.String() != string(data[100:]) || r.Len() != 0 {
+		t.Fatalf("WriteTo wrote %d bytes, left %d", out.Len(), r.Len())
+	}
+	if n, err := r.WriteTo(&out); n != 0 || err != nil {
+		t.Errorf("WriteTo of an empty Rope = %d, %v; want 0, nil", n, err)
+	}
+
+	// a failed write consumes only what was written
+	r.Write(data)
+	w := &failWriter{max: chunk + 10}
+	if n, err := r.WriteTo(w); n != chunk+10 || err != errFail {
+		t.Fatalf("failing WriteTo = %d, %v; want %d, %v", n, err, chunk+10, errFail)
+	}
+	rest, _ := io.ReadAll(&r)
+	if string(rest) != string(data[chunk+10:]) {
+		t.Errorf("after a failed WriteTo the Rope holds %d bytes; want %d", len(rest), len(data)-chunk-10)
+	}
+}
+
+func TestRopeWriteToConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	data := ropeData(4*chunk + 1)
+	done := make(chan []byte)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			done <- nil
+			return
+		}
+		b, _ := io.ReadAll(c)
+		c.Close()
+		done <- b
+	}()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Rope
+	r.Write(data)
+	if n, err := r.WriteTo(c); n != int64(len(data)) || err != nil {
+		t.Fatalf("WriteTo = %d, %v; want %d, nil", n, err, len(data))
+	}
+	c.Close()
+	if got := <-done; string(got) != string(data) {
+		t.Errorf("peer read %d bytes, differing from the %d written", len(got), len(data))
+	}
+}
+
+func TestRopePool(t *testing.T) {
+	var r Rope
+	r.Write(make([]byte, 3*chunk+1)) // four chunks
+
+	// chunks read to the end go back as the reads pass them
+	puts := poolStat(t, chunk).Puts
+	r.Read(make([]byte, 2*chunk))
+	if got := poolStat(t, chunk).Puts - puts; got != 2 {
+		t.Errorf("reading two chunks put %d back; want 2", got)
+	}
+
+	// and the rest on Reset
+	puts = poolStat(t, chunk).Puts
+	r.Reset()
+	if got := poolStat(t, chunk).Puts - puts; got != 2 {
+		t.Errorf("Reset put %d chunks back; want 2", got)
+	}
+	if r.Len() != 0 {
+		t.Errorf("Len() after Reset = %d", r.Len())
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte after Reset = %v; want EOF", err)
+	}
+	r.WriteString("abc")
+	if b, _ := io.ReadAll(&r); string(b) != "abc" {
+		t.Errorf("Rope after Reset read %q; want %q", b, "abc")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// A SyncBuffer is a Buffer that is safe for concurrent use, for instance
+// to capture the output of a log.Logger while goroutines are still
+// writing to it. It has the method set of Buffer, except that Bytes and
+// Next return copies rather than slices aliasing the buffer contents,
+// as those could change as soon as the method returns.
+// The zero value for SyncBuffer is an empty buffer ready to use.
+// 测试里用 bytes.Buffer 收集异步日志会被 race detector 报出来
+type SyncBuffer struct {
+	mu      sync.Mutex
+	b       Buffer
+	changed chan struct{} // closed on the next write; nil if no one waits
+}
+
+// written wakes up the goroutines waiting in WaitFor.
+// It must be called with s.mu held.
+func (s *SyncBuffer) written() {
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+// Snapshot returns a copy of the unread portion of the buffer, taken
+// atomically with respect to concurrent writes.
+func (s *SyncBuffer) Snapshot() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.b.Bytes()...)
+}
+
+// WaitFor waits until the unread portion of the buffer contains substr
+// or timeout has elapsed, and reports whether substr was found.
+func (s *SyncBuffer) WaitFor(substr string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.WaitForContext(ctx, substr) == nil
+}
+
+// WaitForContext waits until the unread portion of the buffer contains
+// substr or ctx is done. It returns nil if substr was found and ctx.Err()
+// otherwise; a buffer already holding substr satisfies it even if ctx
+// is done.
+func (s *SyncBuffer) WaitForContext(ctx context.Context, substr string) error {
+	sep := []byte(substr)
+	for {
+		s.mu.Lock()
+		if Index(s.b.Bytes(), sep) >= 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		if s.changed == nil {
+			s.changed = make(chan struct{})
+		}
+		ch := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Bytes returns a copy of the unread portion of the buffer; it is the
+// same as Snapshot.
+func (s *SyncBuffer) Bytes() []byte { return s.Snapshot() }
+
+// String returns the contents of the unread portion of the buffer
+// as a string. If the SyncBuffer is a nil pointer, it returns "<nil>".
+func (s *SyncBuffer) String() string {
+	if s == nil {
+		// Special case, useful in debugging.
+		return "<nil>"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// Len returns the number of bytes of the unread portion of the buffer.
+func (s *SyncBuffer) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Len()
+}
+
+// Cap returns the capacity of the buffer's underlying byte slice.
+func (s *SyncBuffer) Cap() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Cap()
+}
+
+// Truncate discards all but the first n unread bytes from the buffer,
+// as Buffer.Truncate does.
+func (s *SyncBuffer) Truncate(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.b.Truncate(n)
+}
+
+// Reset resets the buffer to be empty.
+func (s *SyncBuffer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.b.Reset()
+}
+
+// Release empties the buffer and gives its storage back to the shared
+// slice pool, as Buffer.Release does.
+func (s *SyncBuffer) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.b.Release()
+}
+
+// Grow grows the buffer's capacity, if necessary, to guarantee space for
+// another n bytes, as Buffer.Grow does.
+func (s *SyncBuffer) Grow(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.b.Grow(n)
+}
+
+// Write appends the contents of p to the buffer. The return value n is
+// the length of p; err is always nil.
+func (s *SyncBuffer) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.written()
+	return s.b.Write(p)
+}
+
+// WriteString appends the contents of str to the buffer. The return
+// value n is the length of str; err is always nil.
+func (s *SyncBuffer) WriteString(str string) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.written()
+	return s.b.WriteString(str)
+}
+
+// WriteByte appends the byte c to the buffer. The returned error is
+// always nil.
+func (s *SyncBuffer) WriteByte(c byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.written()
+	return s.b.WriteByte(c)
+}
+
+// WriteRune appends the UTF-8 encoding of Unicode code point r to the
+// buffer, returning its length and an error, which is always nil.
+func (s *SyncBuffer) WriteRune(r rune) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.written()
+	return s.b.WriteRune(r)
+}
+
+// ReadFrom reads data from r until EOF and appends it to the buffer.
+// The reads from r are made without holding the lock, so other methods
+// can be called while ReadFrom waits for r; the data is appended a
+// chunk at a time. The return value n is the number of bytes read.
+// Any error except io.EOF encountered during the read is also returned.
+func (s *SyncBuffer) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := GetSlice(MinRead)
+	defer PutSlice(buf)
+	for {
+		m, e := r.Read(buf)
+		if m < 0 {
+			panic(errNegativeRead)
+		}
+		if m > 0 {
+			s.Write(buf[:m])
+			n += int64(m)
+		}
+		if e == io.EOF {
+			return n, nil // e is EOF, so return nil explicitly
+		}
+		if e != nil {
+			return n, e
+		}
+	}
+}
+
+// WriteTo writes data to w until the buffer is drained or an error
+// occurs, as Buffer.WriteTo does. The lock is held while writing to w.
+func (s *SyncBuffer) WriteTo(w io.Writer) (n int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.WriteTo(w)
+}
+
+// Read reads the next len(p) bytes from the buffer or until the buffer
+// is drained, as Buffer.Read does.
+func (s *SyncBuffer) Read(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Read(p)
+}
+
+// Next returns a copy of the next n bytes from the buffer, advancing
+// the buffer as if the bytes had been returned by Read.
+func (s *SyncBuffer) Next(n int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.b.Next(n)...)
+}
+
+// ReadByte reads and returns the next byte from the buffer.
+// If no byte is available, it returns error io.EOF.
+func (s *SyncBuffer) ReadByte() (byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.ReadByte()
+}
+
+// ReadRune reads and returns the next UTF-8-encoded Unicode code point
+// from the buffer, as Buffer.ReadRune does.
+func (s *SyncBuffer) ReadRune() (r rune, size int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.ReadRune()
+}
+
+// UnreadRune unreads the last rune returned by ReadRune, as
+// Buffer.UnreadRune does. Writes by other goroutines in between make
+// it fail.
+func (s *SyncBuffer) UnreadRune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.UnreadRune()
+}
+
+// UnreadByte unreads the last byte returned by the most recent
+// successful read operation, as Buffer.UnreadByte does.
+func (s *SyncBuffer) UnreadByte() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.UnreadByte()
+}
+
+// ReadBytes reads until the first occurrence of delim in the input,
+// returning a slice containing the data up to and including the
+// delimiter, as Buffer.ReadBytes does.
+func (s *SyncBuffer) ReadBytes(delim byte) (line []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.ReadBytes(delim)
+}
+
+// ReadString reads until the first occurrence of delim in the input,
+// returning a string containing the data up to and including the
+// delimiter, as Buffer.ReadString does.
+func (s *SyncBuffer) ReadString(delim byte) (line string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.ReadString(delim)
+}
+
+// ReadBytesLimit is like ReadBytes, but fails with a *TokenTooLongError
+// if delim is not within the first max unread bytes, as
+// Buffer.ReadBytesLimit does.
+func (s *SyncBuffer) ReadBytesLimit(delim byte, max int) (line []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.ReadBytesLimit(delim, max)
+}
+
+// ReadSliceFunc reads until the first byte c for which f(c) is true, as
+// Buffer.ReadSliceFunc does, but returns a copy of the bytes read.
+// f is called with the lock held.
+func (s *SyncBuffer) ReadSliceFunc(f func(c byte) bool, max int) (line []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line, err = s.b.ReadSliceFunc(f, max)
+	return append([]byte(nil), line...), err
+}
+
+// IndexByte returns the index of the first instance of c in the unread
+// portion of the buffer, or -1 if c is not present.
+func (s *SyncBuffer) IndexByte(c byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.IndexByte(c)
+}
+
+// Index returns the index of the first instance of sep in the unread
+// portion of the buffer, or -1 if sep is not present.
+func (s *SyncBuffer) Index(sep []byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Index(sep)
+}
@@ -0,0 +1,170 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bytes_test
+
+import (
+	. "bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncBufferSnapshot(t *testing.T) {
+	var s SyncBuffer
+	s.WriteString("abc")
+	snap := s.Snapshot()
+	snap[0] = 'X'
+	s.WriteString("def")
+	if string(snap) != "Xbc" || s.String() != "abcdef" {
+		t.Fatalf("Snapshot = %q, buffer %q; want an independent copy", snap, s.String())
+	}
+	b := s.Bytes()
+	b[0] = 'Y'
+	n := s.Next(2)
+	n[0] = 'Z'
+	if s.String() != "cdef" {
+		t.Errorf("buffer changed through Bytes or Next: %q", s.String())
+	}
+	if snap := s.Snapshot(); string(snap) != "cdef" {
+		t.Errorf("Snapshot after Next(2) = %q; want %q", snap, "cdef")
+	}
+	var nilBuf *SyncBuffer
+	if nilBuf.String() != "<nil>" {
+		t.Errorf("nil SyncBuffer String() = %q", nilBuf.String())
+	}
+}
+
+func TestSyncBufferWaitFor(t *testing.T) {
+	var s SyncBuffer
+	s.WriteString("ready\n")
+	if !s.WaitFor("ready", 0) {
+		t.Error("WaitFor of data already written failed")
+	}
+	start := time.Now()
+	if s.WaitFor("missing", 20*time.Millisecond) {
+		t.Error("WaitFor of data never written succeeded")
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("WaitFor returned after %v; want the 20ms timeout", d)
+	}
+
+	// later writes wake up the waiter, which looks again until it matches
+	go func() {
+		for _, w := range []string{"do", "ne ", "x", "done!"} {
+			time.Sleep(5 * time.Millisecond)
+			s.WriteString(w)
+		}
+	}()
+	if !s.WaitFor("done!", 10*time.Second) {
+		t.Fatalf("WaitFor missed a later write; buffer holds %q", s.String())
+	}
+}
+
+func TestSyncBufferWaitForContext(t *testing.T) {
+	var s SyncBuffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := s.WaitForContext(ctx, "x"); err != context.Canceled {
+		t.Errorf("WaitForContext with a canceled ctx = %v; want %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.WaitForContext(ctx, "x"); err != context.DeadlineExceeded {
+		t.Errorf("WaitForContext past its deadline = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	// a match wins over a ctx that is already done
+	s.WriteString("x")
+	if err := s.WaitForContext(ctx, "x"); err != nil {
+		t.Errorf("WaitForContext of data already written = %v; want nil", err)
+	}
+
+	// every waiter is woken by the same write
+	var wg sync.WaitGroup
+	errc := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			errc <- s.WaitForContext(ctx, "go")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	s.WriteString("go")
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		if err != nil {
+			t.Errorf("waiter: %v", err)
+		}
+	}
+}
+
+func TestSyncBufferConcurrent(t *testing.T) {
+	const writers, lines = 8, 200
+	var s SyncBuffer
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				switch j % 3 {
+				case 0:
+					fmt.Fprintf(&s, "g%d-%d\n", i, j)
+				case 1:
+					s.WriteString(fmt.Sprintf("g%d-%d\n", i, j))
+				case 2:
+					s.ReadFrom(strings.NewReader(fmt.Sprintf("g%d-%d\n", i, j)))
+				}
+			}
+		}(i)
+	}
+	// readers that do not consume run alongside the writers
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for k := 0; k < 100; k++ {
+			_ = s.Snapshot()
+			_ = s.Len()
+			_ = s.String()
+			_ = s.Index([]byte("g1-"))
+		}
+	}()
+	if !s.WaitFor(fmt.Sprintf("g3-%d\n", lines-1), 10*time.Second) {
+		t.Fatal("WaitFor did not see the last line of writer 3")
+	}
+	wg.Wait()
+	<-done
+
+	// each line was written whole, and each writer's lines are in order
+	next := make([]int, writers)
+	for {
+		line, err := s.ReadString('\n')
+		if err != nil {
+			break
+		}
+		var i, j int
+		if _, err := fmt.Sscanf(line, "g%d-%d\n", &i, &j); err != nil || i < 0 || i >= writers {
+			t.Fatalf("garbled line %q", line)
+		}
+		if j != next[i] {
+			t.Fatalf("writer %d: line %d after %d", i, j, next[i]-1)
+		}
+		next[i]++
+	}
+	for i, n := range next {
+		if n != lines {
+			t.Errorf("writer %d: read %d lines; want %d", i, n, lines)
+		}
+	}
+}
@@ -13,8 +13,11 @@
 package io
 
 import (
+	"context"
 	"errors"
+	"math"
 	"sync"
+	"time"
 )
 
 // Seek whence values.
@@ -462,6 +465,138 @@ func copyBuffer(dst Writer, src Reader, buf []byte) (written int64, err error) {
 	return written, err
 }
 
+// A ProgressFunc is called by CopyContext each time data has been
+// copied, with the total number of bytes copied so far and the average
+// throughput since the start of the copy in bytes per second.
+type ProgressFunc func(written int64, bytesPerSec float64)
+
+// CopyContext is like Copy, but stops when ctx is done and returns
+// ctx.Err(). If progress is not nil, it is called after each chunk of
+// data has been copied.
+//
+// When ctx is done, CopyContext interrupts a blocked Read or Write by
+// setting a deadline in the past with SetReadDeadline on src and
+// SetWriteDeadline on dst, if they have those methods, as connections,
+// files and the pipes of this package do. The deadlines are left set.
+// Otherwise the context is only checked before each Read and Write, so
+// one that blocks delays the return until it completes.
+//
+// As with Copy, if src implements WriterTo the copy is done by
+// src.WriteTo(dst), and otherwise if dst implements ReaderFrom by
+// dst.ReadFrom(src), so that sendfile and splice stay in use. The context
+// is checked before and after that call, and progress is called once,
+// when it returns; only the deadlines can stop it early.
+// io.Copy 一旦开始就只能等 EOF 或出错；这里在每次 Read/Write 之间检查 ctx
+func CopyContext(ctx context.Context, dst Writer, src Reader, progress ProgressFunc) (written int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	defer interruptOnDone(ctx, dst, src)()
+	c := &copyState{ctx: ctx, progress: progress, start: time.Now()}
+	if wt, ok := src.(WriterTo); ok {
+		written, err = wt.WriteTo(dst)
+	} else if rt, ok := dst.(ReaderFrom); ok {
+		written, err = rt.ReadFrom(src)
+	} else {
+		written, err = copyBuffer(ctxWriter{c, dst}, ctxReader{c, src}, nil)
+	}
+	c.add(written - c.n) // the fast paths report only here
+	if err != nil && ctx.Err() != nil {
+		// most likely the deadline set by interruptOnDone
+		err = ctx.Err()
+	}
+	return written, err
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// interruptOnDone sets a deadline in the past on whichever of dst and
+// src supports one as soon as ctx is done. The returned function stops
+// watching ctx; once it returns, no deadline will be set.
+func interruptOnDone(ctx context.Context, dst Writer, src Reader) (stop func()) {
+	rd, _ := src.(readDeadliner)
+	wd, _ := dst.(writeDeadliner)
+	if ctx.Done() == nil || rd == nil && wd == nil {
+		return func() {}
+	}
+	stopc := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			past := time.Unix(1, 0)
+			if rd != nil {
+				rd.SetReadDeadline(past)
+			}
+			if wd != nil {
+				wd.SetWriteDeadline(past)
+			}
+		case <-stopc:
+		}
+	}()
+	return func() {
+		close(stopc)
+		<-done
+	}
+}
+
+// copyState is shared by the wrappers of a CopyContext.
+type copyState struct {
+	ctx      context.Context
+	progress ProgressFunc
+	start    time.Time
+	n        int64 // bytes copied so far
+}
+
+func (c *copyState) add(n int64) {
+	if n <= 0 {
+		return
+	}
+	c.n += n
+	if c.progress != nil {
+		var rate float64
+		if d := time.Since(c.start); d > 0 {
+			rate = float64(c.n) / d.Seconds()
+		}
+		c.progress(c.n, rate)
+	}
+}
+
+// ctxReader checks the context before each Read.
+type ctxReader struct {
+	*copyState
+	r Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ctxWriter checks the context before each Write and reports progress.
+type ctxWriter struct {
+	*copyState
+	w Writer
+}
+
+func (w ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	w.add(int64(n))
+	return n, err
+}
+
 // LimitReader returns a Reader that reads from r
 // but stops with EOF after n bytes.
 // The underlying implementation is a *LimitedReader.
@@ -488,6 +623,193 @@ func (l *LimitedReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// A RateLimiter is a token bucket that limits the throughput of the
+// readers and writers returned by NewRateLimitedReader and
+// NewRateLimitedWriter. The bucket holds up to burst bytes and refills
+// at a steady rate; a transfer waits until the bucket has enough for it.
+// One RateLimiter may be shared by many streams to cap their aggregate
+// throughput. A RateLimiter is safe for concurrent use.
+// 备份、上传限速；多个流共用一个 RateLimiter 就是总带宽上限
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second; 0 means unlimited
+	burst  int
+	tokens float64 // may go negative: bytes reserved by waiting transfers
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSec bytes per
+// second with bursts of up to burst bytes. A bytesPerSec of 0 or less
+// means no limit. If burst is less than 1, it is set to one second's
+// worth of bytes.
+func NewRateLimiter(bytesPerSec int64, burst int) *RateLimiter {
+	l := new(RateLimiter)
+	l.SetRate(bytesPerSec, burst)
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// SetRate changes the rate and burst of l, as for NewRateLimiter.
+// It applies to the transfers that start waiting after the call.
+func (l *RateLimiter) SetRate(bytesPerSec int64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	if burst < 1 {
+		burst = int(bytesPerSec)
+		if bytesPerSec == 0 {
+			burst = int(^uint(0) >> 1) // no limit, no need to split transfers
+		} else if burst < 1 {
+			burst = 1
+		}
+	}
+	l.rate = float64(bytesPerSec)
+	l.burst = burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+}
+
+// Burst returns the largest amount of bytes a single wait may take
+// without going into debt; readers and writers transfer at most Burst
+// bytes at a time.
+func (l *RateLimiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// refill adds the tokens earned since the last call.
+// It must be called with l.mu held.
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// WaitN waits until n bytes may be transferred, or until ctx is done,
+// in which case it returns ctx.Err() and gives the reservation back.
+// Waiters are served in the order they call WaitN.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	// reserve now, pay with time: later waiters queue up behind us
+	d := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.refund(n)
+		return ctx.Err()
+	}
+}
+
+// refund gives back the tokens of n bytes that were waited for but not
+// transferred.
+func (l *RateLimiter) refund(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return
+	}
+	l.refill(time.Now())
+	l.tokens += float64(n)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// NewRateLimitedReader returns a Reader that reads from r no faster
+// than l allows. A Read returns at most l.Burst() bytes and waits,
+// after reading, until l has tokens for them; if ctx is done meanwhile,
+// it returns the bytes with ctx.Err().
+func NewRateLimitedReader(ctx context.Context, r Reader, l *RateLimiter) Reader {
+	return &rateLimitedReader{ctx, r, l}
+}
+
+type rateLimitedReader struct {
+	ctx context.Context
+	r   Reader
+	l   *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if b := r.l.Burst(); len(p) > b {
+		p = p[:b]
+	}
+	n, err = r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.WaitN(r.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// NewRateLimitedWriter returns a Writer that writes to w no faster
+// than l allows. Data is written in pieces of at most l.Burst() bytes,
+// each after waiting for tokens; if ctx is done meanwhile, Write
+// returns the count written so far with ctx.Err(). If w accepts fewer
+// bytes than it was given, Write returns ErrShortWrite unless w reported
+// an error, and the tokens of the bytes not accepted are given back to l.
+func NewRateLimitedWriter(ctx context.Context, w Writer, l *RateLimiter) Writer {
+	return &rateLimitedWriter{ctx, w, l}
+}
+
+type rateLimitedWriter struct {
+	ctx context.Context
+	w   Writer
+	l   *RateLimiter
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if b := w.l.Burst(); len(chunk) > b {
+			chunk = chunk[:b]
+		}
+		if err = w.l.WaitN(w.ctx, len(chunk)); err != nil {
+			return n, err
+		}
+		m, werr := w.w.Write(chunk)
+		if m < len(chunk) {
+			w.l.refund(len(chunk) - m)
+		}
+		n += m
+		if werr != nil {
+			return n, werr
+		}
+		if m < len(chunk) {
+			return n, ErrShortWrite
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
 // NewSectionReader returns a SectionReader that reads from r
 // starting at offset off and stops with EOF after n bytes.
 func NewSectionReader(r ReaderAt, off int64, n int64) *SectionReader {
@@ -555,6 +877,146 @@ func (s *SectionReader) ReadAt(p []byte, off int64) (n int, err error) {
 // Size returns the size of the section in bytes.
 func (s *SectionReader) Size() int64 { return s.limit - s.base }
 
+// ErrSectionFull is returned by the writes of a SectionWriter that do
+// not fit in its section. The part that fits is still written.
+var ErrSectionFull = errors.New("io: write beyond end of section")
+
+// NewSectionWriter returns a SectionWriter that writes to w
+// starting at offset off and stops with ErrSectionFull after n bytes.
+// A section reaching past the largest int64 offset ends there.
+// SectionReader 的写端：并发分块下载时每个 goroutine 只能写自己那一段
+func NewSectionWriter(w WriterAt, off int64, n int64) *SectionWriter {
+	var limit int64
+	if off <= math.MaxInt64-n {
+		limit = n + off
+	} else {
+		// Overflow, with no way to return error.
+		limit = math.MaxInt64
+	}
+	return &SectionWriter{w, off, off, limit}
+}
+
+// SectionWriter implements Write, Seek, and WriteAt on a section
+// of an underlying WriterAt. Writes never reach outside the section,
+// so SectionWriters on disjoint sections of one WriterAt, such as
+// an *os.File, may be used by different goroutines at once.
+type SectionWriter struct {
+	w     WriterAt
+	base  int64
+	off   int64
+	limit int64
+}
+
+func (s *SectionWriter) Write(p []byte) (n int, err error) {
+	if s.off >= s.limit {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, ErrSectionFull
+	}
+	full := false
+	if max := s.limit - s.off; int64(len(p)) > max {
+		p = p[0:max]
+		full = true
+	}
+	n, err = s.w.WriteAt(p, s.off)
+	s.off += int64(n)
+	if err == nil && full {
+		err = ErrSectionFull
+	}
+	return
+}
+
+func (s *SectionWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	default:
+		return 0, errWhence
+	case SeekStart:
+		offset += s.base
+	case SeekCurrent:
+		offset += s.off
+	case SeekEnd:
+		offset += s.limit
+	}
+	if offset < s.base {
+		return 0, errOffset
+	}
+	s.off = offset
+	return offset - s.base, nil
+}
+
+// WriteAt writes p at offset off of the section. It writes the part
+// of p that fits and returns ErrSectionFull if that is not all of it;
+// an empty p always fits.
+func (s *SectionWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errOffset
+	}
+	if off >= s.limit-s.base {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, ErrSectionFull
+	}
+	off += s.base
+	if max := s.limit - off; int64(len(p)) > max {
+		p = p[0:max]
+		n, err = s.w.WriteAt(p, off)
+		if err == nil {
+			err = ErrSectionFull
+		}
+		return n, err
+	}
+	return s.w.WriteAt(p, off)
+}
+
+// Size returns the size of the section in bytes.
+func (s *SectionWriter) Size() int64 { return s.limit - s.base }
+
+// An OffsetWriter maps writes at offset base to offset base+off
+// in the underlying writer. Unlike a SectionWriter it has no end.
+type OffsetWriter struct {
+	w    WriterAt
+	base int64 // the original offset
+	off  int64 // the current offset
+}
+
+// NewOffsetWriter returns an OffsetWriter that writes to w
+// starting at offset off.
+func NewOffsetWriter(w WriterAt, off int64) *OffsetWriter {
+	return &OffsetWriter{w, off, off}
+}
+
+func (o *OffsetWriter) Write(p []byte) (n int, err error) {
+	n, err = o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return
+}
+
+func (o *OffsetWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errOffset
+	}
+	off += o.base
+	return o.w.WriteAt(p, off)
+}
+
+func (o *OffsetWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	default:
+		return 0, errWhence
+	case SeekStart:
+		offset += o.base
+	case SeekCurrent:
+		offset += o.off
+	}
+	if offset < o.base {
+		return 0, errOffset
+	}
+	o.off = offset
+	return offset - o.base, nil
+}
+
 // TeeReader returns a Reader that writes to w what it reads from r.
 // All reads from r performed through it are matched with
 // corresponding writes to w. There is no internal buffering -
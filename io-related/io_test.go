@@ -0,0 +1,543 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"context"
+	"errors"
+	. "io"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// halfWriter accepts half of each write, without an error.
+type halfWriter struct {
+	n int
+}
+
+func (w *halfWriter) Write(p []byte) (int, error) {
+	m := (len(p) + 1) / 2
+	w.n += m
+	return m, nil
+}
+
+func TestRateLimitedWriterShortWrite(t *testing.T) {
+	// one byte per second: only the initial burst can be spent in time
+	l := NewRateLimiter(1, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hw := new(halfWriter)
+	w := NewRateLimitedWriter(ctx, hw, l)
+	n, err := w.Write(make([]byte, 100))
+	if n != 50 || err != ErrShortWrite || hw.n != 50 {
+		t.Fatalf("Write = %d, %v; underlying writer got %d bytes; want 50, ErrShortWrite, 50", n, err, hw.n)
+	}
+	// the tokens of the 50 bytes not written were given back
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := l.WaitN(ctx, 50); err != nil {
+		t.Errorf("WaitN for the refunded tokens: %v", err)
+	}
+}
+
+// zeroWriter accepts nothing, without an error.
+type zeroWriter struct{}
+
+func (zeroWriter) Write([]byte) (int, error) { return 0, nil }
+
+func TestRateLimitedWriterNoProgress(t *testing.T) {
+	l := NewRateLimiter(1000, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := NewRateLimitedWriter(context.Background(), zeroWriter{}, l)
+		if n, err := w.Write(make([]byte, 10)); n != 0 || err != ErrShortWrite {
+			t.Errorf("Write to a writer accepting nothing = %d, %v; want 0, ErrShortWrite", n, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Write to a writer accepting nothing did not return")
+	}
+}
+
+func TestRateLimiterWaitNContext(t *testing.T) {
+	l := NewRateLimiter(10, 10)
+	if err := l.WaitN(context.Background(), 10); err != nil {
+		t.Fatalf("WaitN of the burst: %v", err)
+	}
+
+	// 100 bytes at 10 B/s would take ten seconds
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if err := l.WaitN(ctx, 100); err != context.Canceled {
+		t.Errorf("canceled WaitN = %v; want %v", err, context.Canceled)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 100); err != context.DeadlineExceeded {
+		t.Errorf("WaitN past its deadline = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("WaitN returned %v after its context was done", d)
+	}
+
+	// the abandoned reservations were given back, so one byte is soon due
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := l.WaitN(ctx, 1); err != nil {
+		t.Errorf("WaitN after abandoned waits: %v", err)
+	}
+
+	// an unlimited RateLimiter still reports a done context
+	if err := NewRateLimiter(0, 0).WaitN(ctx, 1<<20); err != nil {
+		t.Errorf("unlimited WaitN = %v; want nil", err)
+	}
+	cancel()
+	if err := NewRateLimiter(0, 0).WaitN(ctx, 1); err != context.Canceled {
+		t.Errorf("unlimited WaitN with a canceled ctx = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestRateLimiterSetRate(t *testing.T) {
+	// 1000 bytes at 1000 B/s in chunks of 100: about 900ms
+	l := NewRateLimiter(1000, 100)
+	var dst countWriter
+	w := NewRateLimitedWriter(context.Background(), &dst, l)
+	time.AfterFunc(150*time.Millisecond, func() { l.SetRate(0, 0) })
+	start := time.Now()
+	if n, err := w.Write(make([]byte, 1000)); n != 1000 || err != nil {
+		t.Fatalf("Write = %d, %v; want 1000, nil", n, err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond || d > 700*time.Millisecond {
+		t.Errorf("Write took %v; want the limit lifted after about 150ms", d)
+	}
+	if b := l.Burst(); b < 1<<30 {
+		t.Errorf("Burst() of an unlimited RateLimiter = %d", b)
+	}
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	// alone, each writer would need 100ms after the burst; together,
+	// they share 2000 B/s and need 250ms
+	l := NewRateLimiter(2000, 100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	var dst [2]countWriter
+	for i := range dst {
+		wg.Add(1)
+		go func(dst *countWriter) {
+			defer wg.Done()
+			w := NewRateLimitedWriter(context.Background(), dst, l)
+			if n, err := w.Write(make([]byte, 300)); n != 300 || err != nil {
+				t.Errorf("Write = %d, %v; want 300, nil", n, err)
+			}
+		}(&dst[i])
+	}
+	wg.Wait()
+	if d := time.Since(start); d < 200*time.Millisecond || d > 5*time.Second {
+		t.Errorf("two writers sharing the limit took %v; want about 250ms", d)
+	}
+	if dst[0].n != 300 || dst[1].n != 300 {
+		t.Errorf("writers wrote %d and %d bytes; want 300 each", dst[0].n, dst[1].n)
+	}
+}
+
+// chunkReader returns n bytes of 'x' in reads of at most size bytes.
+// It has neither WriteTo nor a deadline, so CopyContext takes the slow
+// path on it.
+type chunkReader struct {
+	n, size int
+	reads   int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, EOF
+	}
+	r.reads++
+	m := r.size
+	if m > len(p) {
+		m = len(p)
+	}
+	if m > r.n {
+		m = r.n
+	}
+	for i := range p[:m] {
+		p[i] = 'x'
+	}
+	r.n -= m
+	return m, nil
+}
+
+// countWriter counts the bytes written to it and hides any other method.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestCopyContextProgress(t *testing.T) {
+	src := &chunkReader{n: 10000, size: 1000}
+	var dst countWriter
+	var calls []int64
+	n, err := CopyContext(context.Background(), &dst, src, func(written int64, rate float64) {
+		if rate < 0 {
+			t.Errorf("negative rate %v", rate)
+		}
+		calls = append(calls, written)
+	})
+	if n != 10000 || err != nil || dst.n != 10000 {
+		t.Fatalf("CopyContext = %d, %v, wrote %d; want 10000, nil, 10000", n, err, dst.n)
+	}
+	if len(calls) != 10 {
+		t.Fatalf("progress called %d times; want 10", len(calls))
+	}
+	for i, w := range calls {
+		if w != int64(i+1)*1000 {
+			t.Errorf("progress call %d got %d bytes; want %d", i, w, (i+1)*1000)
+		}
+	}
+}
+
+func TestCopyContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src := &chunkReader{n: 100, size: 10}
+	var dst countWriter
+	n, err := CopyContext(ctx, &dst, src, func(int64, float64) { t.Error("progress called") })
+	if n != 0 || err != context.Canceled || src.reads != 0 || dst.n != 0 {
+		t.Errorf("CopyContext with a canceled ctx = %d, %v after %d reads; want 0, %v, no reads", n, err, src.reads, context.Canceled)
+	}
+}
+
+func TestCopyContextCancelMidCopy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &chunkReader{n: 1 << 30, size: 10}
+	var dst countWriter
+	n, err := CopyContext(ctx, &dst, src, func(written int64, _ float64) {
+		if written == 100 {
+			cancel()
+		}
+	})
+	if n != 100 || err != context.Canceled || dst.n != 100 {
+		t.Errorf("CopyContext canceled after 100 bytes = %d, %v, wrote %d; want 100, %v, 100", n, err, dst.n, context.Canceled)
+	}
+}
+
+// fastSrc implements WriterTo; its Read must not be used.
+type fastSrc struct {
+	dst Writer // the writer WriteTo expects to be given
+}
+
+func (fastSrc) Read([]byte) (int, error) { panic("Read called instead of WriteTo") }
+
+func (s fastSrc) WriteTo(w Writer) (int64, error) {
+	if w != s.dst {
+		return 0, errors.New("WriteTo got a wrapped writer")
+	}
+	n, err := w.Write([]byte("hello, world"))
+	return int64(n), err
+}
+
+// fastDst implements ReaderFrom; its Write must not be used.
+type fastDst struct {
+	src Reader // the reader ReadFrom expects to be given
+	n   int64
+}
+
+func (*fastDst) Write([]byte) (int, error) { panic("Write called instead of ReadFrom") }
+
+func (d *fastDst) ReadFrom(r Reader) (int64, error) {
+	if r != d.src {
+		return 0, errors.New("ReadFrom got a wrapped reader")
+	}
+	p := make([]byte, 7)
+	for {
+		m, err := r.Read(p)
+		d.n += int64(m)
+		if err == EOF {
+			return d.n, nil
+		}
+		if err != nil {
+			return d.n, err
+		}
+	}
+}
+
+func TestCopyContextFastPaths(t *testing.T) {
+	var progress []int64
+	record := func(written int64, _ float64) { progress = append(progress, written) }
+
+	var dst countWriter
+	n, err := CopyContext(context.Background(), &dst, fastSrc{&dst}, record)
+	if n != 12 || err != nil || dst.n != 12 {
+		t.Errorf("CopyContext from a WriterTo = %d, %v; want 12, nil", n, err)
+	}
+	if len(progress) != 1 || progress[0] != 12 {
+		t.Errorf("progress from a WriterTo = %v; want one call with 12", progress)
+	}
+
+	progress = nil
+	src := &chunkReader{n: 50, size: 5}
+	n, err = CopyContext(context.Background(), &fastDst{src: src}, src, record)
+	if n != 50 || err != nil {
+		t.Errorf("CopyContext to a ReaderFrom = %d, %v; want 50, nil", n, err)
+	}
+	if len(progress) != 1 || progress[0] != 50 {
+		t.Errorf("progress from a ReaderFrom = %v; want one call with 50", progress)
+	}
+}
+
+func TestCopyContextInterruptsBlockedCalls(t *testing.T) {
+	// a Read blocked on a pipe with no writer
+	r, w := Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var dst countWriter
+	errc := make(chan error, 1)
+	go func() {
+		_, err := CopyContext(ctx, &dst, r, nil)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err != context.DeadlineExceeded {
+			t.Errorf("CopyContext from a blocked pipe = %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("blocked Read was not interrupted")
+	}
+
+	// a Write blocked on a pipe with no reader
+	r, w = Pipe()
+	defer r.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		_, err := CopyContext(ctx, w, &chunkReader{n: 100, size: 10}, nil)
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("CopyContext to a blocked pipe = %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("blocked Write was not interrupted")
+	}
+}
+
+// memWriterAt is a WriterAt on a fixed slice that records the offsets
+// it is asked to write at.
+type memWriterAt struct {
+	mu   sync.Mutex
+	b    []byte
+	offs []int64
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offs = append(m.offs, off)
+	if off < 0 || off > int64(len(m.b)) {
+		return 0, errors.New("memWriterAt: offset out of range")
+	}
+	return copy(m.b[off:], p), nil
+}
+
+func (m *memWriterAt) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return string(m.b)
+}
+
+func newMemWriterAt() *memWriterAt {
+	return &memWriterAt{b: []byte("............")}
+}
+
+func TestSectionWriterWriteAt(t *testing.T) {
+	tests := []struct {
+		data string
+		off  int64
+		n    int
+		err  error
+		want string
+	}{
+		{"ab", 0, 2, nil, "....ab......"},
+		{"abcd", 0, 4, nil, "....abcd...."},
+		{"ab", 3, 1, ErrSectionFull, ".......a...."}, // partly outside
+		{"abcdef", 0, 4, ErrSectionFull, "....abcd...."},
+		{"a", 4, 0, ErrSectionFull, "............"},
+		{"a", 100, 0, ErrSectionFull, "............"},
+		{"", 4, 0, nil, "............"}, // at Size
+		{"", 0, 0, nil, "............"},
+	}
+	for _, tt := range tests {
+		m := newMemWriterAt()
+		s := NewSectionWriter(m, 4, 4)
+		n, err := s.WriteAt([]byte(tt.data), tt.off)
+		if n != tt.n || err != tt.err || m.String() != tt.want {
+			t.Errorf("WriteAt(%q, %d) = %d, %v, leaving %q; want %d, %v, %q", tt.data, tt.off, n, err, m.String(), tt.n, tt.err, tt.want)
+		}
+	}
+	s := NewSectionWriter(newMemWriterAt(), 4, 4)
+	if n, err := s.WriteAt([]byte("a"), -1); n != 0 || err == nil {
+		t.Errorf("WriteAt at a negative offset = %d, %v; want an error", n, err)
+	}
+	if n, err := s.WriteAt(nil, s.Size()); n != 0 || err != nil {
+		t.Errorf("WriteAt(nil, Size()) = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestSectionWriterSeek(t *testing.T) {
+	m := newMemWriterAt()
+	s := NewSectionWriter(m, 4, 4)
+	if n, err := s.Write([]byte("ab")); n != 2 || err != nil {
+		t.Fatalf("Write = %d, %v; want 2, nil", n, err)
+	}
+	if n, err := s.Write([]byte("cdef")); n != 2 || err != ErrSectionFull {
+		t.Fatalf("Write past the end = %d, %v; want 2, ErrSectionFull", n, err)
+	}
+	if n, err := s.Write([]byte("g")); n != 0 || err != ErrSectionFull {
+		t.Errorf("Write at the end = %d, %v; want 0, ErrSectionFull", n, err)
+	}
+	if n, err := s.Write(nil); n != 0 || err != nil {
+		t.Errorf("empty Write at the end = %d, %v; want 0, nil", n, err)
+	}
+	if m.String() != "....abcd...." {
+		t.Fatalf("section writes left %q", m.String())
+	}
+
+	seeks := []struct {
+		off    int64
+		whence int
+		pos    int64
+		ok     bool
+	}{
+		{0, SeekStart, 0, true},
+		{1, SeekCurrent, 1, true},
+		{-1, SeekEnd, 3, true},
+		{0, SeekEnd, 4, true},
+		{10, SeekStart, 10, true}, // past the end is allowed
+		{-1, SeekStart, 0, false},
+		{-5, SeekEnd, 0, false},
+		{0, 42, 0, false},
+	}
+	for _, tt := range seeks {
+		s.Seek(0, SeekStart)
+		pos, err := s.Seek(tt.off, tt.whence)
+		if (err == nil) != tt.ok || tt.ok && pos != tt.pos {
+			t.Errorf("Seek(%d, %d) = %d, %v; want %d, ok %v", tt.off, tt.whence, pos, err, tt.pos, tt.ok)
+		}
+	}
+
+	s.Seek(-1, SeekEnd)
+	s.Write([]byte("Z"))
+	s.Seek(10, SeekStart)
+	if n, err := s.Write([]byte("Q")); n != 0 || err != ErrSectionFull {
+		t.Errorf("Write after seeking past the end = %d, %v; want 0, ErrSectionFull", n, err)
+	}
+	if m.String() != "....abcZ...." {
+		t.Errorf("after Seek and Write: %q", m.String())
+	}
+}
+
+func TestSectionWriterOverflow(t *testing.T) {
+	m := newMemWriterAt()
+	s := NewSectionWriter(m, 4, math.MaxInt64)
+	if size := s.Size(); size != math.MaxInt64-4 {
+		t.Errorf("Size() = %d; want %d", size, int64(math.MaxInt64-4))
+	}
+	if n, err := s.Write([]byte("ab")); n != 2 || err != nil {
+		t.Errorf("Write to a section ending at MaxInt64 = %d, %v; want 2, nil", n, err)
+	}
+	if n, err := s.WriteAt([]byte("c"), 4); n != 1 || err != nil {
+		t.Errorf("WriteAt = %d, %v; want 1, nil", n, err)
+	}
+	if m.String() != "....ab..c..." {
+		t.Errorf("writes left %q", m.String())
+	}
+}
+
+func TestSectionWriterConcurrent(t *testing.T) {
+	m := newMemWriterAt()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := NewSectionWriter(m, int64(i*4), 4)
+			c := 'a' + byte(i)
+			if n, err := s.Write([]byte{c, c, c, c, 'X'}); n != 4 || err != ErrSectionFull {
+				t.Errorf("Write to section %d = %d, %v; want 4, ErrSectionFull", i, n, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if m.String() != "aaaabbbbcccc" {
+		t.Errorf("disjoint sections left %q", m.String())
+	}
+}
+
+func TestOffsetWriter(t *testing.T) {
+	m := newMemWriterAt()
+	o := NewOffsetWriter(m, 4)
+	if n, err := o.Write([]byte("ab")); n != 2 || err != nil {
+		t.Fatalf("Write = %d, %v; want 2, nil", n, err)
+	}
+	if pos, err := o.Seek(1, SeekCurrent); pos != 3 || err != nil {
+		t.Errorf("Seek(1, SeekCurrent) = %d, %v; want 3, nil", pos, err)
+	}
+	o.Write([]byte("c"))
+	if n, err := o.WriteAt([]byte("XY"), 6); n != 2 || err != nil {
+		t.Errorf("WriteAt = %d, %v; want 2, nil", n, err)
+	}
+	if m.String() != "....ab.c..XY" {
+		t.Fatalf("writes left %q", m.String())
+	}
+	// WriteAt does not move the offset used by Write
+	o.Write([]byte("d"))
+	if m.String() != "....ab.cd.XY" {
+		t.Errorf("Write after WriteAt left %q", m.String())
+	}
+
+	// there is no end to seek from, nor a way before the start
+	for _, tt := range []struct {
+		off    int64
+		whence int
+	}{
+		{0, SeekEnd},
+		{-1, SeekStart},
+		{-10, SeekCurrent},
+		{0, 42},
+	} {
+		if _, err := o.Seek(tt.off, tt.whence); err == nil {
+			t.Errorf("Seek(%d, %d) succeeded", tt.off, tt.whence)
+		}
+	}
+	if pos, err := o.Seek(2, SeekStart); pos != 2 || err != nil {
+		t.Errorf("Seek(2, SeekStart) = %d, %v; want 2, nil", pos, err)
+	}
+	if n, err := o.WriteAt([]byte("z"), -1); n != 0 || err == nil {
+		t.Errorf("WriteAt at a negative offset = %d, %v; want an error", n, err)
+	}
+	// the offsets reaching the underlying writer are all past base
+	for _, off := range m.offs {
+		if off < 4 {
+			t.Errorf("OffsetWriter wrote at %d, before its base", off)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package io
+
+import (
+	"errors"
+	"sync"
+)
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, EOF
+}
+
+type multiReader struct {
+	readers []Reader
+}
+
+func (mr *multiReader) Read(p []byte) (n int, err error) {
+	for len(mr.readers) > 0 {
+		// Optimization to flatten nested multiReaders (Issue 13558).
+		if len(mr.readers) == 1 {
+			if r, ok := mr.readers[0].(*multiReader); ok {
+				mr.readers = r.readers
+				continue
+			}
+		}
+		n, err = mr.readers[0].Read(p)
+		if err == EOF {
+			// Use eofReader instead of nil to avoid nil panic
+			// after performing flatten (Issue 18232).
+			mr.readers[0] = eofReader{} // permit earlier GC
+			mr.readers = mr.readers[1:]
+		}
+		if n > 0 || err != EOF {
+			if err == EOF && len(mr.readers) > 0 {
+				// Don't return EOF yet. More readers remain.
+				err = nil
+			}
+			return
+		}
+	}
+	return 0, EOF
+}
+
+// MultiReader returns a Reader that's the logical concatenation of
+// the provided input readers. They're read sequentially. Once all
+// inputs have returned EOF, Read will return EOF.  If any of the readers
+// return a non-nil, non-EOF error, Read will return that error.
+func MultiReader(readers ...Reader) Reader {
+	r := make([]Reader, len(readers))
+	copy(r, readers)
+	return &multiReader{r}
+}
+
+type multiWriter struct {
+	writers []Writer
+}
+
+func (t *multiWriter) Write(p []byte) (n int, err error) {
+	for _, w := range t.writers {
+		n, err = w.Write(p)
+		if err != nil {
+			return
+		}
+		if n != len(p) {
+			err = ErrShortWrite
+			return
+		}
+	}
+	return len(p), nil
+}
+
+var _ StringWriter = (*multiWriter)(nil)
+
+func (t *multiWriter) WriteString(s string) (n int, err error) {
+	var p []byte // lazily initialized if/when needed
+	for _, w := range t.writers {
+		if sw, ok := w.(StringWriter); ok {
+			n, err = sw.WriteString(s)
+		} else {
+			if p == nil {
+				p = []byte(s)
+			}
+			n, err = w.Write(p)
+		}
+		if err != nil {
+			return
+		}
+		if n != len(s) {
+			err = ErrShortWrite
+			return
+		}
+	}
+	return len(s), nil
+}
+
+// MultiWriter creates a writer that duplicates its writes to all the
+// provided writers, similar to the Unix tee(1) command.
+//
+// Each write is written to each listed writer, one at a time.
+// If a listed writer returns an error, that overall write operation
+// stops and returns the error; it does not continue down the list.
+// 一个 sink 出错整个写入就停下；需要容忍坏 sink 时用 FanOutWriter
+func MultiWriter(writers ...Writer) Writer {
+	allWriters := make([]Writer, 0, len(writers))
+	for _, w := range writers {
+		if mw, ok := w.(*multiWriter); ok {
+			allWriters = append(allWriters, mw.writers...)
+		} else {
+			allWriters = append(allWriters, w)
+		}
+	}
+	return &multiWriter{allWriters}
+}
+
+// A FanOutPolicy says what a FanOutWriter does when one of its sinks
+// fails. In every case the failing sink gets no further writes.
+type FanOutPolicy int
+
+const (
+	// FailFast fails the whole FanOutWriter: later Writes return the
+	// sink's error, and so does Close.
+	FailFast FanOutPolicy = iota
+
+	// DropSink removes the sink and forgets its error.
+	DropSink
+
+	// CollectErrors removes the sink and keeps its error for Close.
+	CollectErrors
+)
+
+var errFanOutClosed = errors.New("io: write to closed FanOutWriter")
+
+// A FanOutError is returned by FanOutWriter.Close and lists the errors
+// of the sinks that failed under the FailFast or CollectErrors policy,
+// in the order they happened.
+type FanOutError struct {
+	Errs []error
+}
+
+func (e *FanOutError) Error() string {
+	// strings imports io, so the messages are joined by hand
+	s := "fan-out: "
+	for i, err := range e.Errs {
+		if i > 0 {
+			s += "; "
+		}
+		s += err.Error()
+	}
+	return s
+}
+
+// A FanOutWriter duplicates its writes to a set of sinks, each written
+// by its own goroutine, so that a slow sink does not hold up the
+// others as long as its buffer has room. Each sink has an error policy
+// and a bound on the data queued for it; see Add.
+//
+// Write copies p, queues it for every live sink and returns; the sinks'
+// errors are reported according to their policies, by later Writes or
+// by Close. Writes are delivered to each sink in order. A FanOutWriter
+// is safe for concurrent use.
+// 与 MultiWriter 不同：sink 并发写入，坏掉的 sink 可以按策略剔除
+type FanOutWriter struct {
+	wmu sync.Mutex // serializes Write and Add, so that every sink sees the same order
+
+	mu     sync.Mutex
+	cond   sync.Cond // signaled when a queue or the set of sinks changes
+	sinks  []*fanOutSink
+	err    error   // first FailFast error
+	errs   []error // FailFast and CollectErrors errors
+	closed bool
+	wg     sync.WaitGroup // sink goroutines
+}
+
+type fanOutSink struct {
+	w      Writer
+	policy FanOutPolicy
+	max    int      // bytes that may be queued
+	queue  [][]byte // shared, read-only copies of the written data
+	queued int      // bytes in queue
+	dead   bool
+}
+
+// NewFanOutWriter returns a FanOutWriter without sinks.
+func NewFanOutWriter() *FanOutWriter {
+	f := new(FanOutWriter)
+	f.cond.L = &f.mu
+	return f
+}
+
+// Add adds w to the sinks of f, which receives the data of the Writes
+// that follow. Up to bufSize bytes may be queued for w; a Write that
+// does not fit waits until w has caught up. A single Write larger than
+// bufSize is queued once the queue is empty. Add after Close panics.
+func (f *FanOutWriter) Add(w Writer, policy FanOutPolicy, bufSize int) {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		panic("io: FanOutWriter.Add after Close")
+	}
+	s := &fanOutSink{w: w, policy: policy, max: bufSize}
+	f.sinks = append(f.sinks, s)
+	f.wg.Add(1)
+	go f.run(s)
+}
+
+// Write queues p for every live sink. It returns len(p), nil unless
+// the FanOutWriter has failed or is closed. That may also happen while
+// Write waits for room in the queue of a slow sink; Write then returns
+// 0 and the error, although p may already be queued for the sinks
+// before that one, which still write it.
+func (f *FanOutWriter) Write(p []byte) (n int, err error) {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errFanOutClosed
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// the sinks write after Write returns and p may be reused by then
+	buf := append([]byte(nil), p...)
+	sinks := f.sinks // a sink removed while we wait is marked dead
+	for _, s := range sinks {
+		for !s.dead && s.queued > 0 && s.queued+len(buf) > s.max && f.err == nil && !f.closed {
+			f.cond.Wait()
+		}
+		if f.closed {
+			return 0, errFanOutClosed
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if s.dead {
+			continue
+		}
+		s.queue = append(s.queue, buf)
+		s.queued += len(buf)
+		f.cond.Broadcast()
+	}
+	return len(p), nil
+}
+
+// Close waits until every live sink has written the data queued for it
+// and stops the sink goroutines. It does not close the sinks. A Write
+// still waiting for room in a queue fails with an error. Close returns
+// a *FanOutError if any sink failed under the FailFast or CollectErrors
+// policy.
+func (f *FanOutWriter) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	f.cond.Broadcast()
+	f.mu.Unlock()
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.errs) == 0 {
+		return nil
+	}
+	return &FanOutError{Errs: f.errs}
+}
+
+// run writes the queue of s until f is closed and the queue is empty,
+// or s fails.
+func (f *FanOutWriter) run(s *fanOutSink) {
+	defer f.wg.Done()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		for len(s.queue) == 0 && !f.closed {
+			f.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			return
+		}
+		p := s.queue[0]
+		f.mu.Unlock()
+		n, err := s.w.Write(p)
+		if err == nil && n != len(p) {
+			err = ErrShortWrite
+		}
+		f.mu.Lock()
+		s.queue[0] = nil // permit earlier GC
+		s.queue = s.queue[1:]
+		s.queued -= len(p)
+		if err != nil {
+			f.fail(s, err)
+			return
+		}
+		f.cond.Broadcast()
+	}
+}
+
+// fail removes s from the sinks of f and applies its error policy.
+// It must be called with f.mu held.
+func (f *FanOutWriter) fail(s *fanOutSink, err error) {
+	s.dead = true
+	s.queue = nil
+	s.queued = 0
+	sinks := make([]*fanOutSink, 0, len(f.sinks))
+	for _, t := range f.sinks {
+		if t != s {
+			sinks = append(sinks, t)
+		}
+	}
+	f.sinks = sinks
+	switch s.policy {
+	case FailFast:
+		if f.err == nil {
+			f.err = err
+		}
+		f.errs = append(f.errs, err)
+	case CollectErrors:
+		f.errs = append(f.errs, err)
+	}
+	f.cond.Broadcast()
+}
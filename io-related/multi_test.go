@@ -0,0 +1,254 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"errors"
+	. "io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sinkWriter records what a FanOutWriter sink goroutine writes to it.
+// A non-nil gate holds every Write until it is closed.
+type sinkWriter struct {
+	gate chan struct{}
+	mu   sync.Mutex
+	b    strings.Builder
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	if w.gate != nil {
+		<-w.gate
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.b.Write(p)
+}
+
+func (w *sinkWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.b.String()
+}
+
+// failingWriter accepts n writes and fails the ones after.
+type failingWriter struct {
+	n   int
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return 0, w.err
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestFanOutWriterDropSink(t *testing.T) {
+	f := NewFanOutWriter()
+	var good sinkWriter
+	f.Add(&good, FailFast, 16)
+	f.Add(&failingWriter{n: 1, err: errors.New("bad")}, DropSink, 16)
+	for i := 0; i < 10; i++ {
+		if _, err := f.Write([]byte("ab")); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close = %v; want nil for a dropped sink", err)
+	}
+	if s := good.String(); s != strings.Repeat("ab", 10) {
+		t.Errorf("good sink got %q", s)
+	}
+}
+
+func TestFanOutWriterCollectErrors(t *testing.T) {
+	f := NewFanOutWriter()
+	var good sinkWriter
+	bad := errors.New("bad")
+	f.Add(&good, FailFast, 16)
+	f.Add(&failingWriter{n: 2, err: bad}, CollectErrors, 16)
+	for i := 0; i < 10; i++ {
+		if _, err := f.Write([]byte("ab")); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+	err := f.Close()
+	fe, ok := err.(*FanOutError)
+	if !ok || len(fe.Errs) != 1 || fe.Errs[0] != bad {
+		t.Fatalf("Close = %v; want a FanOutError holding bad", err)
+	}
+	if s := fe.Error(); s != "fan-out: bad" {
+		t.Errorf("FanOutError.Error() = %q", s)
+	}
+	if s := good.String(); s != strings.Repeat("ab", 10) {
+		t.Errorf("good sink got %q", s)
+	}
+}
+
+func TestFanOutWriterFailFast(t *testing.T) {
+	f := NewFanOutWriter()
+	bad := errors.New("bad")
+	f.Add(new(sinkWriter), DropSink, 16)
+	f.Add(&failingWriter{err: bad}, FailFast, 16)
+
+	// the failure is reported by a later Write once the sink has run
+	deadline := time.Now().Add(5 * time.Second)
+	var err error
+	for err == nil && time.Now().Before(deadline) {
+		_, err = f.Write([]byte("x"))
+		time.Sleep(time.Millisecond)
+	}
+	if err != bad {
+		t.Fatalf("Write after a FailFast sink failed = %v; want bad", err)
+	}
+	if _, err := f.Write([]byte("x")); err != bad {
+		t.Errorf("second Write = %v; want bad", err)
+	}
+	if err, ok := f.Close().(*FanOutError); !ok || len(err.Errs) != 1 || err.Errs[0] != bad {
+		t.Errorf("Close = %v; want a FanOutError holding bad", err)
+	}
+}
+
+func TestFanOutWriterSlowSink(t *testing.T) {
+	f := NewFanOutWriter()
+	slow := &sinkWriter{gate: make(chan struct{})}
+	var fast sinkWriter
+	f.Add(slow, FailFast, 4)
+	f.Add(&fast, FailFast, 4)
+
+	// the slow sink's goroutine takes "ab" and blocks; "cd" fits its queue
+	f.Write([]byte("ab"))
+	f.Write([]byte("cd"))
+	deadline := time.Now().Add(5 * time.Second)
+	for fast.String() != "abcd" {
+		if time.Now().After(deadline) {
+			t.Fatalf("fast sink got %q while the slow one was stuck", fast.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// a Write that does not fit waits for the slow sink
+	done := make(chan struct{})
+	go func() {
+		f.Write([]byte("efgh"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Write did not wait for a full sink queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(slow.gate)
+	<-done
+	if err := f.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if s := slow.String(); s != "abcdefgh" {
+		t.Errorf("slow sink got %q", s)
+	}
+	if s := fast.String(); s != "abcdefgh" {
+		t.Errorf("fast sink got %q", s)
+	}
+}
+
+func TestFanOutWriterClosed(t *testing.T) {
+	f := NewFanOutWriter()
+	f.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Add after Close did not panic")
+		}
+	}()
+	f.Add(new(sinkWriter), DropSink, 1)
+}
+
+// gatedFailWriter fails every Write once its gate is closed.
+type gatedFailWriter struct {
+	gate chan struct{}
+	err  error
+}
+
+func (w *gatedFailWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	return 0, w.err
+}
+
+func TestFanOutWriterFailFastWhileWaiting(t *testing.T) {
+	f := NewFanOutWriter()
+	bad := errors.New("bad")
+	var first sinkWriter
+	failing := &gatedFailWriter{gate: make(chan struct{}), err: bad}
+	f.Add(&first, DropSink, 16)
+	f.Add(failing, FailFast, 1)
+
+	// the failing sink takes "a" and blocks; "b" waits for room in its queue
+	f.Write([]byte("a"))
+	errc := make(chan error, 1)
+	go func() {
+		n, err := f.Write([]byte("b"))
+		if n != 0 {
+			t.Errorf("failed Write = %d; want 0", n)
+		}
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(failing.gate)
+	if err := <-errc; err != bad {
+		t.Errorf("Write waiting on a failing sink = %v; want bad", err)
+	}
+	f.Close()
+	// "b" reached the sink queued before the failing one
+	if s := first.String(); s != "ab" {
+		t.Errorf("first sink got %q; want %q", s, "ab")
+	}
+}
+
+func TestFanOutWriterCloseDuringWrite(t *testing.T) {
+	f := NewFanOutWriter()
+	slow := &sinkWriter{gate: make(chan struct{})}
+	f.Add(slow, FailFast, 1)
+
+	// the sink takes "a" and blocks; "b" waits for room in its queue
+	f.Write([]byte("a"))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := f.Write([]byte("b"))
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- f.Close() }()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Write waiting when Close was called succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not wake up a waiting Write")
+	}
+
+	// Close still waits for the data already queued
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the sink wrote its queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(slow.gate)
+	if err := <-closed; err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if s := slow.String(); s != "a" {
+		t.Errorf("sink got %q; want %q", s, "a")
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Pipe adapter to connect code expecting an io.Reader
+// with code expecting an io.Writer.
+
+package io
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// onceError is an object that will only store an error once.
+type onceError struct {
+	sync.Mutex // guards following
+	err        error
+}
+
+func (a *onceError) Store(err error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.err != nil {
+		return
+	}
+	a.err = err
+}
+func (a *onceError) Load() error {
+	a.Lock()
+	defer a.Unlock()
+	return a.err
+}
+
+// ErrClosedPipe is the error used for read or write operations on a closed pipe.
+var ErrClosedPipe = errors.New("io: read/write on closed pipe")
+
+// ErrDeadlineExceeded is returned by the Read of a PipeReader or the
+// Write of a PipeWriter whose deadline has passed. It has the Timeout
+// method of net.Error, which reports true.
+var ErrDeadlineExceeded error = &deadlineExceededError{}
+
+type deadlineExceededError struct{}
+
+func (e *deadlineExceededError) Error() string   { return "i/o timeout" }
+func (e *deadlineExceededError) Timeout() bool   { return true }
+func (e *deadlineExceededError) Temporary() bool { return true }
+
+// pipeDeadline is an abstraction for handling timeouts.
+// 与 net.Pipe 中的同名类型一致：到期时关闭 cancel，阻塞的一端在 select 中醒来
+type pipeDeadline struct {
+	mu     sync.Mutex // Guards timer and cancel
+	timer  *time.Timer
+	cancel chan struct{} // Must be non-nil
+}
+
+func makePipeDeadline() pipeDeadline {
+	return pipeDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will time out.
+// A timeout event is signaled by closing the channel returned by waiter.
+// Once a timeout has occurred, the deadline can be refreshed by specifying a
+// t value in the future.
+//
+// A zero value for t prevents timeout.
+func (d *pipeDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	// Time is zero, then there is no deadline.
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	// Time in the future, setup a timer to cancel in the future.
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		d.timer = time.AfterFunc(dur, func() {
+			close(d.cancel)
+		})
+		return
+	}
+
+	// Time in the past, so close immediately.
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *pipeDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// A pipe is the shared pipe structure underlying PipeReader and PipeWriter.
+type pipe struct {
+	wrMu sync.Mutex // Serializes Write operations
+	wrCh chan []byte
+	rdCh chan int
+
+	once sync.Once // Protects closing done
+	done chan struct{}
+	rerr onceError
+	werr onceError
+
+	rdDeadline pipeDeadline
+	wrDeadline pipeDeadline
+
+	// Buffered pipes only; buf is nil for a synchronous pipe.
+	rdMu     sync.Mutex // Serializes Read operations
+	mu       sync.Mutex // Guards r and n
+	buf      []byte
+	r        int           // read position in buf
+	n        int           // number of unread bytes in buf
+	readable chan struct{} // holds a token after a write
+	writable chan struct{} // holds a token after a read
+}
+
+func (p *pipe) read(b []byte) (n int, err error) {
+	if p.buf != nil {
+		return p.readBuffered(b)
+	}
+
+	select {
+	case <-p.done:
+		return 0, p.readCloseError()
+	default:
+	}
+	if isClosedChan(p.rdDeadline.wait()) {
+		return 0, ErrDeadlineExceeded
+	}
+
+	select {
+	case bw := <-p.wrCh:
+		nr := copy(b, bw)
+		p.rdCh <- nr
+		return nr, nil
+	case <-p.done:
+		return 0, p.readCloseError()
+	case <-p.rdDeadline.wait():
+		return 0, ErrDeadlineExceeded
+	}
+}
+
+// readBuffered returns the data buffered by earlier writes, waiting for
+// some if there is none. The data written before the write end was
+// closed is still returned.
+func (p *pipe) readBuffered(b []byte) (n int, err error) {
+	p.rdMu.Lock()
+	defer p.rdMu.Unlock()
+
+	for {
+		if p.rerr.Load() != nil {
+			return 0, ErrClosedPipe
+		}
+		if isClosedChan(p.rdDeadline.wait()) {
+			return 0, ErrDeadlineExceeded
+		}
+		p.mu.Lock()
+		if p.n > 0 {
+			n = p.copyOut(b)
+			p.mu.Unlock()
+			notify(p.writable)
+			return n, nil
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-p.readable:
+		case <-p.done:
+			p.mu.Lock()
+			empty := p.n == 0
+			p.mu.Unlock()
+			if empty {
+				return 0, p.readCloseError()
+			}
+		case <-p.rdDeadline.wait():
+			return 0, ErrDeadlineExceeded
+		}
+	}
+}
+
+// copyOut moves unread bytes from buf to b and returns their number.
+// It must be called with p.mu held.
+func (p *pipe) copyOut(b []byte) int {
+	m := p.n
+	if m > len(b) {
+		m = len(b)
+	}
+	end := p.r + m
+	if end <= len(p.buf) {
+		copy(b, p.buf[p.r:end])
+	} else {
+		k := copy(b, p.buf[p.r:])
+		copy(b[k:m], p.buf)
+	}
+	p.r = end % len(p.buf)
+	p.n -= m
+	return m
+}
+
+// copyIn appends as much of b to the unread bytes as fits in buf and
+// returns the number of bytes copied.
+// It must be called with p.mu held.
+func (p *pipe) copyIn(b []byte) int {
+	w := (p.r + p.n) % len(p.buf)
+	free := len(p.buf) - p.n
+	if free > len(b) {
+		free = len(b)
+	}
+	k := copy(p.buf[w:], b[:free])
+	copy(p.buf, b[k:free])
+	p.n += free
+	return free
+}
+
+// notify leaves a token in c unless there is one already.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pipe) closeRead(err error) error {
+	if err == nil {
+		err = ErrClosedPipe
+	}
+	p.rerr.Store(err)
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *pipe) write(b []byte) (n int, err error) {
+	if p.buf != nil {
+		return p.writeBuffered(b)
+	}
+
+	select {
+	case <-p.done:
+		return 0, p.writeCloseError()
+	default:
+		p.wrMu.Lock()
+		defer p.wrMu.Unlock()
+	}
+
+	for once := true; once || len(b) > 0; once = false {
+		if isClosedChan(p.wrDeadline.wait()) {
+			return n, ErrDeadlineExceeded
+		}
+		select {
+		case p.wrCh <- b:
+			nw := <-p.rdCh
+			b = b[nw:]
+			n += nw
+		case <-p.done:
+			return n, p.writeCloseError()
+		case <-p.wrDeadline.wait():
+			return n, ErrDeadlineExceeded
+		}
+	}
+	return n, nil
+}
+
+// writeBuffered copies b into buf, waiting for room as long as it is
+// full.
+func (p *pipe) writeBuffered(b []byte) (n int, err error) {
+	p.wrMu.Lock()
+	defer p.wrMu.Unlock()
+
+	for {
+		select {
+		case <-p.done:
+			return n, p.writeCloseError()
+		default:
+		}
+		if len(b) == 0 {
+			return n, nil
+		}
+		if isClosedChan(p.wrDeadline.wait()) {
+			return n, ErrDeadlineExceeded
+		}
+		p.mu.Lock()
+		m := p.copyIn(b)
+		p.mu.Unlock()
+		if m > 0 {
+			notify(p.readable)
+			b = b[m:]
+			n += m
+			continue
+		}
+
+		select {
+		case <-p.writable:
+		case <-p.done:
+			return n, p.writeCloseError()
+		case <-p.wrDeadline.wait():
+			return n, ErrDeadlineExceeded
+		}
+	}
+}
+
+func (p *pipe) closeWrite(err error) error {
+	if err == nil {
+		err = EOF
+	}
+	p.werr.Store(err)
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+// readCloseError is considered internal to the pipe type.
+func (p *pipe) readCloseError() error {
+	rerr := p.rerr.Load()
+	if werr := p.werr.Load(); rerr == nil && werr != nil {
+		return werr
+	}
+	return ErrClosedPipe
+}
+
+// writeCloseError is considered internal to the pipe type.
+func (p *pipe) writeCloseError() error {
+	werr := p.werr.Load()
+	if rerr := p.rerr.Load(); werr == nil && rerr != nil {
+		return rerr
+	}
+	return ErrClosedPipe
+}
+
+// A PipeReader is the read half of a pipe.
+type PipeReader struct {
+	p *pipe
+}
+
+// Read implements the standard Read interface:
+// it reads data from the pipe, blocking until a writer
+// arrives or the write end is closed.
+// If the write end is closed with an error, that error is
+// returned as err; otherwise err is EOF.
+// If the read deadline passes first, err is ErrDeadlineExceeded.
+func (r *PipeReader) Read(data []byte) (n int, err error) {
+	return r.p.read(data)
+}
+
+// Close closes the reader; subsequent writes to the
+// write half of the pipe will return the error ErrClosedPipe.
+func (r *PipeReader) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError closes the reader; subsequent writes
+// to the write half of the pipe will return the error err.
+//
+// CloseWithError never overwrites the previous error if it exists
+// and always returns nil.
+func (r *PipeReader) CloseWithError(err error) error {
+	return r.p.closeRead(err)
+}
+
+// SetReadDeadline sets the deadline for pending and future Read calls.
+// A Read that has not returned by then fails with ErrDeadlineExceeded;
+// the deadline can be extended by setting it again. A zero value for t
+// means Read will not time out. After Close, SetReadDeadline returns
+// ErrClosedPipe.
+func (r *PipeReader) SetReadDeadline(t time.Time) error {
+	if r.p.rerr.Load() != nil {
+		return ErrClosedPipe
+	}
+	r.p.rdDeadline.set(t)
+	return nil
+}
+
+// SetDeadline is the same as SetReadDeadline, the only direction of a
+// PipeReader. It lets a PipeReader be used where a net.Conn style
+// deadline setter is expected.
+func (r *PipeReader) SetDeadline(t time.Time) error {
+	return r.SetReadDeadline(t)
+}
+
+// A PipeWriter is the write half of a pipe.
+type PipeWriter struct {
+	p *pipe
+}
+
+// Write implements the standard Write interface:
+// it writes data to the pipe, blocking until one or more readers
+// have consumed all the data or the read end is closed.
+// If the read end is closed with an error, that err is
+// returned as err; otherwise err is ErrClosedPipe.
+// If the write deadline passes first, err is ErrDeadlineExceeded and n
+// counts the bytes that were consumed (or buffered) before it.
+func (w *PipeWriter) Write(data []byte) (n int, err error) {
+	return w.p.write(data)
+}
+
+// Close closes the writer; subsequent reads from the
+// read half of the pipe will return no bytes and EOF.
+func (w *PipeWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError closes the writer; subsequent reads from the
+// read half of the pipe will return no bytes and the error err,
+// or EOF if err is nil.
+//
+// CloseWithError never overwrites the previous error if it exists
+// and always returns nil.
+func (w *PipeWriter) CloseWithError(err error) error {
+	return w.p.closeWrite(err)
+}
+
+// SetWriteDeadline sets the deadline for pending and future Write calls.
+// A Write that has not returned by then fails with ErrDeadlineExceeded;
+// the deadline can be extended by setting it again. A zero value for t
+// means Write will not time out. After Close, SetWriteDeadline returns
+// ErrClosedPipe.
+func (w *PipeWriter) SetWriteDeadline(t time.Time) error {
+	if w.p.werr.Load() != nil {
+		return ErrClosedPipe
+	}
+	w.p.wrDeadline.set(t)
+	return nil
+}
+
+// SetDeadline is the same as SetWriteDeadline, the only direction of a
+// PipeWriter. It lets a PipeWriter be used where a net.Conn style
+// deadline setter is expected.
+func (w *PipeWriter) SetDeadline(t time.Time) error {
+	return w.SetWriteDeadline(t)
+}
+
+// Pipe creates a synchronous in-memory pipe.
+// It can be used to connect code expecting an io.Reader
+// with code expecting an io.Writer.
+//
+// Reads and Writes on the pipe are matched one to one
+// except when multiple Reads are needed to consume a single Write.
+// That is, each Write to the PipeWriter blocks until it has satisfied
+// one or more Reads from the PipeReader that fully consume
+// the written data.
+// The data is copied directly from the Write to the corresponding
+// Read (or Reads); there is no internal buffering.
+//
+// It is safe to call Read and Write in parallel with each other or with Close.
+// Parallel calls to Read and parallel calls to Write are also safe:
+// the individual calls will be gated sequentially.
+func Pipe() (*PipeReader, *PipeWriter) {
+	p := &pipe{
+		wrCh:       make(chan []byte),
+		rdCh:       make(chan int),
+		done:       make(chan struct{}),
+		rdDeadline: makePipeDeadline(),
+		wrDeadline: makePipeDeadline(),
+	}
+	return &PipeReader{p}, &PipeWriter{p}
+}
+
+// BufferedPipe creates an in-memory pipe that holds up to size bytes
+// written but not yet read. A Write returns as soon as its data has
+// been buffered and blocks only while the buffer is full; a Read
+// returns the buffered data and blocks only while there is none.
+// Data buffered before the write end is closed can still be read;
+// closing the read end discards it.
+//
+// Like Pipe, it is safe to call Read, Write and Close in parallel.
+// BufferedPipe panics if size is not positive.
+// Pipe 的每次 Write 都要等到 Read 取走数据，生产者和消费者速度不一致时用它做缓冲
+func BufferedPipe(size int) (*PipeReader, *PipeWriter) {
+	if size <= 0 {
+		panic("io.BufferedPipe: non-positive size")
+	}
+	p := &pipe{
+		done:       make(chan struct{}),
+		rdDeadline: makePipeDeadline(),
+		wrDeadline: makePipeDeadline(),
+		buf:        make([]byte, size),
+		readable:   make(chan struct{}, 1),
+		writable:   make(chan struct{}, 1),
+	}
+	return &PipeReader{p}, &PipeWriter{p}
+}
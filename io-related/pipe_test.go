@@ -0,0 +1,182 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package io_test
+
+import (
+	"errors"
+	. "io"
+	"testing"
+	"time"
+)
+
+// pipes are the constructors the tests below run against.
+var pipes = []struct {
+	name string
+	make func() (*PipeReader, *PipeWriter)
+}{
+	{"Pipe", Pipe},
+	{"BufferedPipe", func() (*PipeReader, *PipeWriter) { return BufferedPipe(7) }},
+}
+
+func TestPipeTransfer(t *testing.T) {
+	for _, tt := range pipes {
+		r, w := tt.make()
+		go func() {
+			for i := 0; i < 100; i++ {
+				w.Write([]byte("hello, world"))
+			}
+			w.CloseWithError(errors.New("done"))
+		}()
+		total := 0
+		p := make([]byte, 5)
+		var err error
+		for err == nil {
+			var n int
+			n, err = r.Read(p)
+			total += n
+		}
+		if total != 1200 || err == nil || err.Error() != "done" {
+			t.Errorf("%s: read %d bytes, %v; want 1200, done", tt.name, total, err)
+		}
+	}
+}
+
+func TestPipeDeadline(t *testing.T) {
+	for _, tt := range pipes {
+		r, w := tt.make()
+		r.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+		if _, err := r.Read(make([]byte, 1)); err != ErrDeadlineExceeded {
+			t.Errorf("%s: Read past the deadline: %v", tt.name, err)
+		}
+		if te, ok := ErrDeadlineExceeded.(interface{ Timeout() bool }); !ok || !te.Timeout() {
+			t.Errorf("ErrDeadlineExceeded is not a timeout")
+		}
+
+		// nobody reads: Write blocks until its deadline, after what fit
+		w.SetDeadline(time.Now().Add(20 * time.Millisecond))
+		n, err := w.Write(make([]byte, 20))
+		if err != ErrDeadlineExceeded {
+			t.Errorf("%s: Write past the deadline: %d, %v", tt.name, n, err)
+		}
+		if want := map[string]int{"Pipe": 0, "BufferedPipe": 7}[tt.name]; n != want {
+			t.Errorf("%s: Write past the deadline wrote %d bytes; want %d", tt.name, n, want)
+		}
+
+		// a deadline in the future can be extended, and a zero one removed
+		w.SetWriteDeadline(time.Time{})
+		r.SetDeadline(time.Now().Add(time.Hour))
+		go w.Write([]byte("x"))
+		p := make([]byte, 10)
+		if n, err := r.Read(p); n == 0 || err != nil {
+			t.Errorf("%s: Read after resetting the deadline: %d, %v", tt.name, n, err)
+		}
+		r.Close()
+		w.Close()
+	}
+}
+
+func TestPipeDeadlineWakesBlocked(t *testing.T) {
+	for _, tt := range pipes {
+		r, _ := tt.make()
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.Read(make([]byte, 1))
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		r.SetReadDeadline(time.Now())
+		select {
+		case err := <-done:
+			if err != ErrDeadlineExceeded {
+				t.Errorf("%s: blocked Read returned %v", tt.name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: setting a past deadline did not wake the blocked Read", tt.name)
+		}
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	for _, tt := range pipes {
+		r, w := tt.make()
+		r.CloseWithError(errors.New("gone"))
+		if _, err := w.Write([]byte("x")); err == nil || err.Error() != "gone" {
+			t.Errorf("%s: Write after CloseWithError: %v", tt.name, err)
+		}
+		if _, err := r.Read(make([]byte, 1)); err != ErrClosedPipe {
+			t.Errorf("%s: Read after Close: %v", tt.name, err)
+		}
+		if err := r.SetReadDeadline(time.Time{}); err != ErrClosedPipe {
+			t.Errorf("%s: SetReadDeadline after Close: %v", tt.name, err)
+		}
+
+		r, w = tt.make()
+		w.Close()
+		if _, err := r.Read(make([]byte, 1)); err != EOF {
+			t.Errorf("%s: Read after writer Close: %v", tt.name, err)
+		}
+		if _, err := w.Write([]byte("x")); err != ErrClosedPipe {
+			t.Errorf("%s: Write after Close: %v", tt.name, err)
+		}
+	}
+}
+
+func TestBufferedPipe(t *testing.T) {
+	r, w := BufferedPipe(4)
+
+	// writes that fit return at once, without a reader
+	if n, err := w.Write([]byte("abc")); n != 3 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+
+	// a write that does not fit blocks until the reader makes room
+	done := make(chan int, 1)
+	go func() {
+		n, _ := w.Write([]byte("defg"))
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		t.Fatalf("Write into a full buffer returned %d without blocking", n)
+	case <-time.After(20 * time.Millisecond):
+	}
+	p := make([]byte, 10)
+	var got []byte
+	for len(got) < 7 {
+		n, err := r.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p[:n]...)
+	}
+	if string(got) != "abcdefg" || <-done != 4 {
+		t.Errorf("read %q; want %q", got, "abcdefg")
+	}
+
+	// data written before the writer closed is still delivered
+	w.Write([]byte("hi"))
+	w.CloseWithError(errors.New("bye"))
+	if n, err := r.Read(p); string(p[:n]) != "hi" || err != nil {
+		t.Errorf("Read after writer close = %q, %v; want %q, nil", p[:n], err, "hi")
+	}
+	if _, err := r.Read(p); err == nil || err.Error() != "bye" {
+		t.Errorf("Read of drained pipe = %v; want bye", err)
+	}
+
+	// closing the reader discards the data
+	r, w = BufferedPipe(4)
+	w.Write([]byte("xy"))
+	r.Close()
+	if n, err := r.Read(p); n != 0 || err != ErrClosedPipe {
+		t.Errorf("Read after reader close = %d, %v", n, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("BufferedPipe(0) did not panic")
+		}
+	}()
+	BufferedPipe(0)
+}
@@ -0,0 +1,206 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// An OverflowPolicy tells an AsyncWriter what to do with a record
+// when its queue is full.
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota // wait until the queue has room
+	DropNewest                       // discard the record being written
+	DropOldest                       // discard the oldest queued record to make room
+)
+
+// An AsyncWriter wraps an io.Writer with a bounded queue that is drained
+// by a background goroutine, so that callers do not wait for a slow
+// destination such as a disk or a syslog socket.
+//
+// Write copies p into the queue and returns at once; write errors of the
+// underlying writer are reported by the next Flush or Close. Records
+// dropped because of the OverflowPolicy are counted by Dropped.
+//
+// Logger.Output holds the Logger's mutex across the Write to its output,
+// so with an AsyncWriter as output a slow destination no longer stalls
+// every goroutine that logs. Fatal flushes the output before exiting.
+// Logger.Output 在持有 l.mu 的情况下调用 Write，下游一慢所有打日志的 goroutine 都会被卡住
+type AsyncWriter struct {
+	out    io.Writer
+	policy OverflowPolicy
+	max    int
+
+	mu      sync.Mutex
+	ready   sync.Cond // signaled when a record is queued or the writer is closed
+	idle    sync.Cond // signaled when records leave the queue or have been written
+	queue   [][]byte
+	free    [][]byte // buffers of written records, reused by Write
+	busy    bool     // the flusher is writing records taken from queue
+	closed  bool
+	err     error // first error from out since the last Flush
+	dropped uint64
+	done    chan struct{} // closed when the flusher exits
+}
+
+// ErrAsyncClosed is returned by writes to a closed AsyncWriter.
+var ErrAsyncClosed = errors.New("log: write to closed AsyncWriter")
+
+// NewAsyncWriter returns an AsyncWriter writing to out through a queue
+// holding at most size records. If size is not positive, 1024 is used.
+func NewAsyncWriter(out io.Writer, size int, policy OverflowPolicy) *AsyncWriter {
+	if size <= 0 {
+		size = 1024
+	}
+	w := &AsyncWriter{
+		out:    out,
+		policy: policy,
+		max:    size,
+		queue:  make([][]byte, 0, size),
+		done:   make(chan struct{}),
+	}
+	w.ready.L = &w.mu
+	w.idle.L = &w.mu
+	go w.run()
+	return w
+}
+
+// Write queues a copy of p. It blocks only under the Block policy while
+// the queue is full. It always reports len(p) bytes written unless the
+// writer is closed.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && len(w.queue) >= w.max {
+		switch w.policy {
+		case DropNewest:
+			w.dropped++
+			return len(p), nil
+		case DropOldest:
+			w.release(w.queue[0])
+			copy(w.queue, w.queue[1:])
+			w.queue = w.queue[:len(w.queue)-1]
+			w.dropped++
+		default:
+			w.idle.Wait()
+		}
+	}
+	if w.closed {
+		return 0, ErrAsyncClosed
+	}
+
+	// p belongs to the caller (for a Logger it is l.buf), so copy it
+	var b []byte
+	if n := len(w.free); n > 0 {
+		b = w.free[n-1][:0]
+		w.free = w.free[:n-1]
+	}
+	w.queue = append(w.queue, append(b, p...))
+	w.ready.Signal()
+	return len(p), nil
+}
+
+// Flush waits until every record queued so far has been written and
+// returns the first error the underlying writer reported since the
+// previous Flush. If the underlying writer has a Flush method, it is
+// called too.
+func (w *AsyncWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+// Close flushes the queue, stops the background goroutine and makes
+// further writes fail with ErrAsyncClosed. It does not close the
+// underlying writer.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	err := w.flush()
+	w.closed = true
+	w.ready.Signal()
+	w.idle.Broadcast() // wake writers blocked on a full queue
+	w.mu.Unlock()
+	<-w.done
+	return err
+}
+
+// Dropped returns the number of records discarded because the queue was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// flush implements Flush.
+// It must be called with w.mu held.
+func (w *AsyncWriter) flush() error {
+	for len(w.queue) > 0 || w.busy {
+		w.idle.Wait()
+	}
+	err := w.err
+	w.err = nil
+	if f, ok := w.out.(flusher); ok {
+		if ferr := f.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// release keeps b for reuse by a later Write.
+// It must be called with w.mu held.
+func (w *AsyncWriter) release(b []byte) {
+	if cap(b) <= 64<<10 && len(w.free) < w.max {
+		w.free = append(w.free, b)
+	}
+}
+
+// run is the background flusher. It takes the whole queue at once and
+// writes it without holding w.mu.
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	var batch [][]byte
+	w.mu.Lock()
+	for {
+		for len(w.queue) == 0 && !w.closed {
+			w.ready.Wait()
+		}
+		if len(w.queue) == 0 && w.closed {
+			w.mu.Unlock()
+			return
+		}
+		batch, w.queue = w.queue, batch[:0]
+		w.busy = true
+		w.idle.Broadcast() // the queue has room again
+		w.mu.Unlock()
+
+		var err error
+		for _, b := range batch {
+			if _, werr := w.out.Write(b); werr != nil && err == nil {
+				err = werr
+			}
+		}
+
+		w.mu.Lock()
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		for i, b := range batch {
+			w.release(b)
+			batch[i] = nil
+		}
+		w.busy = false
+		w.idle.Broadcast()
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gateWriter blocks every Write until the gate is opened.
+type gateWriter struct {
+	gate chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (g *gateWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.Write(p)
+}
+
+func (g *gateWriter) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.String()
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	var b bytes.Buffer
+	w := NewAsyncWriter(&b, 4, Block)
+	l := New(w, "", 0)
+	for i := 0; i < 100; i++ {
+		l.Print("x")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), strings.Repeat("x\n", 100); got != want {
+		t.Errorf("got %d bytes; want %d", len(got), len(want))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("late")); err != ErrAsyncClosed {
+		t.Errorf("Write after Close: got %v; want %v", err, ErrAsyncClosed)
+	}
+}
+
+func TestAsyncWriterDrop(t *testing.T) {
+	for _, tt := range []struct {
+		policy OverflowPolicy
+		want   string
+	}{
+		{DropNewest, "0\n1\n2\n"},
+		{DropOldest, "0\n3\n4\n"},
+	} {
+		g := &gateWriter{gate: make(chan struct{})}
+		w := NewAsyncWriter(g, 2, tt.policy)
+		l := New(w, "", 0)
+		l.Print("0")
+		// wait for the flusher to pick up "0" and block in g.Write
+		for {
+			w.mu.Lock()
+			busy := w.busy
+			w.mu.Unlock()
+			if busy {
+				break
+			}
+			runtime.Gosched()
+		}
+		for _, s := range []string{"1", "2", "3", "4"} {
+			l.Print(s)
+		}
+		close(g.gate)
+		w.Close()
+		if got := g.String(); got != tt.want {
+			t.Errorf("policy %d: got %q; want %q", tt.policy, got, tt.want)
+		}
+		if n := w.Dropped(); n != 2 {
+			t.Errorf("policy %d: Dropped = %d; want 2", tt.policy, n)
+		}
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestAsyncWriterError(t *testing.T) {
+	w := NewAsyncWriter(errWriter{}, 0, Block)
+	if _, err := w.Write([]byte("x\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Flush(); err == nil || err.Error() != "disk full" {
+		t.Errorf("Flush: got %v; want disk full", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close: got %v; want nil", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+// A ctxKey maps a context key to the attribute name it is logged under.
+type ctxKey struct {
+	name string
+	key  interface{}
+}
+
+// AddContextKey registers key with the logger: the ...Ctx methods look
+// key up with ctx.Value and, if the value is not nil, add it to the
+// record as an attribute called name. This lets request IDs and trace
+// IDs stored in a context.Context by middleware appear on every line
+// logged while serving that request.
+// 通过 ctx.Value 沿着 valueCtx 链往上找，所以 key 需要是 middleware 里 WithValue 时用的同一个 key
+func (l *Logger) AddContextKey(name string, key interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// copy on write, so that ctxArgs can use the slice without the lock
+	keys := make([]ctxKey, len(l.ctxKeys), len(l.ctxKeys)+1)
+	copy(keys, l.ctxKeys)
+	l.ctxKeys = append(keys, ctxKey{name, key})
+}
+
+// ctxArgs returns args preceded by the attributes found in ctx for the
+// registered context keys.
+func (l *Logger) ctxArgs(ctx context.Context, args []interface{}) []interface{} {
+	l.mu.Lock()
+	keys := l.ctxKeys
+	l.mu.Unlock()
+	if ctx == nil || len(keys) == 0 {
+		return args
+	}
+	var all []interface{}
+	for _, k := range keys {
+		if v := ctx.Value(k.key); v != nil {
+			if all == nil {
+				all = make([]interface{}, 0, len(keys)+len(args))
+			}
+			all = append(all, Attr{k.name, v})
+		}
+	}
+	if all == nil {
+		return args
+	}
+	return append(all, args...)
+}
+
+// PrintCtx is like Print but adds the values of the registered context
+// keys found in ctx to the record. See AddContextKey.
+func (l *Logger) PrintCtx(ctx context.Context, v ...interface{}) {
+	l.output(2, levelNone, fmt.Sprint(v...), l.ctxArgs(ctx, nil))
+}
+
+// PrintfCtx is like Printf but adds the values of the registered context
+// keys found in ctx to the record. See AddContextKey.
+func (l *Logger) PrintfCtx(ctx context.Context, format string, v ...interface{}) {
+	l.output(2, levelNone, fmt.Sprintf(format, v...), l.ctxArgs(ctx, nil))
+}
+
+// PrintlnCtx is like Println but adds the values of the registered context
+// keys found in ctx to the record. See AddContextKey.
+func (l *Logger) PrintlnCtx(ctx context.Context, v ...interface{}) {
+	l.output(2, levelNone, fmt.Sprintln(v...), l.ctxArgs(ctx, nil))
+}
+
+// DebugCtx is like Debug but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func (l *Logger) DebugCtx(ctx context.Context, msg string, args ...interface{}) {
+	l.output(2, LevelDebug, msg, l.ctxArgs(ctx, args))
+}
+
+// InfoCtx is like Info but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func (l *Logger) InfoCtx(ctx context.Context, msg string, args ...interface{}) {
+	l.output(2, LevelInfo, msg, l.ctxArgs(ctx, args))
+}
+
+// WarnCtx is like Warn but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func (l *Logger) WarnCtx(ctx context.Context, msg string, args ...interface{}) {
+	l.output(2, LevelWarn, msg, l.ctxArgs(ctx, args))
+}
+
+// ErrorCtx is like Error but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func (l *Logger) ErrorCtx(ctx context.Context, msg string, args ...interface{}) {
+	l.output(2, LevelError, msg, l.ctxArgs(ctx, args))
+}
+
+// AddContextKey registers key with the standard logger. See Logger.AddContextKey.
+func AddContextKey(name string, key interface{}) {
+	std.AddContextKey(name, key)
+}
+
+// PrintfCtx is like Printf but adds the values of the registered context
+// keys found in ctx to the record. See AddContextKey.
+func PrintfCtx(ctx context.Context, format string, v ...interface{}) {
+	std.output(2, levelNone, fmt.Sprintf(format, v...), std.ctxArgs(ctx, nil))
+}
+
+// PrintCtx is like Print but adds the values of the registered context
+// keys found in ctx to the record. See AddContextKey.
+func PrintCtx(ctx context.Context, v ...interface{}) {
+	std.output(2, levelNone, fmt.Sprint(v...), std.ctxArgs(ctx, nil))
+}
+
+// PrintlnCtx is like Println but adds the values of the registered context
+// keys found in ctx to the record. See AddContextKey.
+func PrintlnCtx(ctx context.Context, v ...interface{}) {
+	std.output(2, levelNone, fmt.Sprintln(v...), std.ctxArgs(ctx, nil))
+}
+
+// DebugCtx is like Debug but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func DebugCtx(ctx context.Context, msg string, args ...interface{}) {
+	std.output(2, LevelDebug, msg, std.ctxArgs(ctx, args))
+}
+
+// InfoCtx is like Info but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func InfoCtx(ctx context.Context, msg string, args ...interface{}) {
+	std.output(2, LevelInfo, msg, std.ctxArgs(ctx, args))
+}
+
+// WarnCtx is like Warn but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func WarnCtx(ctx context.Context, msg string, args ...interface{}) {
+	std.output(2, LevelWarn, msg, std.ctxArgs(ctx, args))
+}
+
+// ErrorCtx is like Error but adds the values of the registered context
+// keys found in ctx before args. See AddContextKey.
+func ErrorCtx(ctx context.Context, msg string, args ...interface{}) {
+	std.output(2, LevelError, msg, std.ctxArgs(ctx, args))
+}
@@ -0,0 +1,33 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+type testCtxKey string
+
+func TestContextKeys(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "", 0)
+	l.AddContextKey("req", testCtxKey("request-id"))
+	l.AddContextKey("trace", testCtxKey("trace-id"))
+
+	ctx := context.WithValue(context.Background(), testCtxKey("request-id"), "r-42")
+	ctx, cancel := context.WithCancel(ctx) // lookups go through the whole chain
+	defer cancel()
+	l.PrintfCtx(ctx, "hello %d\n", 23)
+	l.InfoCtx(ctx, "served", "status", 200)
+	l.PrintCtx(context.Background(), "bare")
+	want := "hello 23 req=r-42\n" +
+		"INFO served req=r-42 status=200\n" +
+		"bare\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
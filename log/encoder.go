@@ -0,0 +1,295 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// A Record holds the data of a single logging event as it is handed
+// to an Encoder.
+type Record struct {
+	Time    time.Time // time of the event
+	File    string    // full file name of the caller; may be empty unless Llongfile or Lshortfile is set
+	Line    int       // line number of the caller
+	Prefix  string    // the Logger's prefix
+	Level   Level     // severity; negative for Print, Fatal, Panic and Output records
+	Message string    // the formatted message
+
+	args []interface{} // attributes, see argsToAttr
+}
+
+// Attrs calls f on each attribute of the record, in order.
+func (r Record) Attrs(f func(Attr)) {
+	args := r.args
+	var a Attr
+	for len(args) > 0 {
+		a, args = argsToAttr(args)
+		f(a)
+	}
+}
+
+// An Encoder formats records for a Logger.
+//
+// AppendRecord appends the encoding of r to buf and returns the extended
+// buffer. The flag argument holds the Logger's flags; encoders use it to
+// decide whether to include the time and the caller's file and line.
+// AppendRecord must not add a trailing newline: the Logger terminates
+// every record with one. It is called with the Logger's mutex held and
+// buf is the Logger's own buffer, so the encoding can be built without
+// extra allocations.
+type Encoder interface {
+	AppendRecord(buf []byte, flag int, r Record) []byte
+}
+
+// JSONEncoder writes each record as a single-line JSON object:
+//
+//	{"time":"2009-01-23T01:23:23Z","level":"INFO","prefix":"app: ","file":"d.go:23","msg":"hello","k":"v"}
+//
+// Fields whose flag is unset or whose value is empty are omitted.
+// Attributes named like one of the fields above are written with an
+// "attr." prefix (see reservedKey).
+type JSONEncoder struct{}
+
+// AppendRecord implements Encoder.
+func (JSONEncoder) AppendRecord(buf []byte, flag int, r Record) []byte {
+	buf = append(buf, '{')
+	if t, layout, ok := recordTime(flag, r.Time); ok {
+		buf = append(buf, `"time":"`...)
+		buf = t.AppendFormat(buf, layout)
+		buf = append(buf, `",`...)
+	}
+	if r.Level >= 0 {
+		buf = append(buf, `"level":"`...)
+		buf = append(buf, r.Level.String()...)
+		buf = append(buf, `",`...)
+	}
+	if r.Prefix != "" {
+		buf = append(buf, `"prefix":`...)
+		buf = appendJSONString(buf, r.Prefix)
+		buf = append(buf, ',')
+	}
+	if flag&(Lshortfile|Llongfile) != 0 {
+		buf = append(buf, `"file":"`...)
+		buf = appendJSONEscaped(buf, recordFile(flag, r.File))
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(r.Line), 10)
+		buf = append(buf, `",`...)
+	}
+	buf = append(buf, `"msg":`...)
+	buf = appendJSONString(buf, trimNewline(r.Message))
+	// walk args directly rather than through Attrs to keep buf off the heap
+	var a Attr
+	for args := r.args; len(args) > 0; {
+		a, args = argsToAttr(args)
+		buf = append(buf, `,"`...)
+		if reservedKey(a.Key) {
+			buf = append(buf, attrKeyPrefix...)
+		}
+		buf = appendJSONEscaped(buf, a.Key)
+		buf = append(buf, `":`...)
+		buf = appendJSONValue(buf, a.Value)
+	}
+	return append(buf, '}')
+}
+
+// LogfmtEncoder writes each record as a single logfmt line:
+//
+//	time=2009-01-23T01:23:23Z level=INFO prefix="app: " file=d.go:23 msg=hello k=v
+//
+// Fields whose flag is unset or whose value is empty are omitted.
+// Attributes named like one of the fields above are written with an
+// "attr." prefix, as by JSONEncoder.
+type LogfmtEncoder struct{}
+
+// AppendRecord implements Encoder.
+func (LogfmtEncoder) AppendRecord(buf []byte, flag int, r Record) []byte {
+	start := len(buf)
+	if t, layout, ok := recordTime(flag, r.Time); ok {
+		buf = append(buf, "time="...)
+		buf = t.AppendFormat(buf, layout)
+	}
+	if r.Level >= 0 {
+		if len(buf) > start {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "level="...)
+		buf = append(buf, r.Level.String()...)
+	}
+	if r.Prefix != "" {
+		if len(buf) > start {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "prefix="...)
+		appendMaybeQuoted(&buf, r.Prefix)
+	}
+	if flag&(Lshortfile|Llongfile) != 0 {
+		if len(buf) > start {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "file="...)
+		appendMaybeQuoted(&buf, recordFile(flag, r.File))
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(r.Line), 10)
+	}
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "msg="...)
+	appendMaybeQuoted(&buf, trimNewline(r.Message))
+	var a Attr
+	for args := r.args; len(args) > 0; {
+		a, args = argsToAttr(args)
+		buf = append(buf, ' ')
+		if reservedKey(a.Key) {
+			buf = append(buf, attrKeyPrefix...)
+		}
+		appendMaybeQuoted(&buf, a.Key)
+		buf = append(buf, '=')
+		appendMaybeQuoted(&buf, valueString(a.Value))
+	}
+	return buf
+}
+
+// attrKeyPrefix is put in front of the attribute keys that are reserved.
+const attrKeyPrefix = "attr."
+
+// reservedKey reports whether key is the name of a field written by the
+// encoders. An attribute with such a key would make a duplicate key, of
+// which most decoders keep only the last: a "msg" attribute would
+// silently replace the message.
+func reservedKey(key string) bool {
+	switch key {
+	case "time", "level", "prefix", "file", "msg":
+		return true
+	}
+	return false
+}
+
+// recordTime reports whether the flags ask for a timestamp and, if so,
+// returns the time adjusted for LUTC and the RFC 3339 layout to use.
+func recordTime(flag int, t time.Time) (time.Time, string, bool) {
+	if flag&(Ldate|Ltime|Lmicroseconds) == 0 {
+		return t, "", false
+	}
+	if flag&LUTC != 0 {
+		t = t.UTC()
+	}
+	if flag&Lmicroseconds != 0 {
+		return t, "2006-01-02T15:04:05.000000Z07:00", true
+	}
+	return t, time.RFC3339, true
+}
+
+// recordFile returns the file name as the flags ask for it.
+func recordFile(flag int, file string) string {
+	if flag&Lshortfile != 0 {
+		return shortFile(file)
+	}
+	return file
+}
+
+func trimNewline(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// appendJSONValue appends v to buf as a JSON value. Numbers and booleans
+// are written as such; everything else is written as a string.
+func appendJSONValue(buf []byte, v interface{}) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case bool:
+		return strconv.AppendBool(buf, x)
+	case int:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(x), 10)
+	case int64:
+		return strconv.AppendInt(buf, x, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(x), 10)
+	case uint64:
+		return strconv.AppendUint(buf, x, 10)
+	case float32:
+		return appendJSONFloat(buf, float64(x), 32)
+	case float64:
+		return appendJSONFloat(buf, x, 64)
+	}
+	return appendJSONString(buf, valueString(v))
+}
+
+func appendJSONFloat(buf []byte, f float64, bits int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		// not representable as a JSON number
+		return appendJSONString(buf, strconv.FormatFloat(f, 'g', -1, bits))
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, bits)
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends s to buf as a quoted JSON string.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONEscaped(buf, s)
+	return append(buf, '"')
+}
+
+// appendJSONEscaped appends s to buf escaped for use inside a JSON string.
+// Invalid UTF-8 is replaced by U+FFFD.
+func appendJSONEscaped(buf []byte, s string) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	return append(buf, s[start:]...)
+}
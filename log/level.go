@@ -0,0 +1,131 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A Level is the importance or severity of a log event.
+// The higher the level, the more important or severe the event.
+type Level int
+
+// Levels understood by the leveled logging methods Debug, Info, Warn and Error.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNone marks an event produced by Print, Fatal, Panic or Output.
+// Such events carry no severity and are never filtered by the minimum level.
+// Print 系列的输出没有 level，也不受 SetLevel 的影响，保证旧代码行为不变
+const levelNone Level = -1
+
+// String returns a name for the level: "DEBUG", "INFO", "WARN" or "ERROR".
+func (lv Level) String() string {
+	switch lv {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "Level(" + strconv.Itoa(int(lv)) + ")"
+}
+
+// An Attr is a key/value pair attached to a log record.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// badKey is the key used for a value that has no key in front of it.
+const badKey = "!BADKEY"
+
+// argsToAttr turns a prefix of args into an Attr and returns the
+// unconsumed portion of args.
+// If args[0] is an Attr, it is returned as is.
+// If args[0] is a string, it is treated as a key and args[1] as its value.
+// Otherwise args[0] is treated as a value with a missing key.
+func argsToAttr(args []interface{}) (Attr, []interface{}) {
+	switch x := args[0].(type) {
+	case Attr:
+		return x, args[1:]
+	case string:
+		if len(args) == 1 {
+			return Attr{badKey, x}, nil
+		}
+		return Attr{x, args[1]}, args[2:]
+	default:
+		return Attr{badKey, x}, args[1:]
+	}
+}
+
+// appendAttrs appends the attributes in args to buf as space-separated
+// key=value pairs, quoting keys and values where needed.
+func appendAttrs(buf *[]byte, args []interface{}) {
+	var a Attr
+	for len(args) > 0 {
+		a, args = argsToAttr(args)
+		*buf = append(*buf, ' ')
+		appendMaybeQuoted(buf, a.Key)
+		*buf = append(*buf, '=')
+		appendMaybeQuoted(buf, valueString(a.Value))
+	}
+}
+
+// valueString formats an attribute value as text, avoiding fmt for the
+// common cases. Errors and Stringers go through fmt, which prints <nil>
+// for a nil pointer whose Error or String method panics.
+func valueString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// appendMaybeQuoted appends s to buf, quoting it if it is empty or
+// contains characters that would make a key=value pair ambiguous.
+func appendMaybeQuoted(buf *[]byte, s string) {
+	if needsQuoting(s) {
+		*buf = strconv.AppendQuote(*buf, s)
+		return
+	}
+	*buf = append(*buf, s...)
+}
+
+func needsQuoting(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b <= ' ' || b == '=' || b == '"' || b == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError {
+			return true
+		}
+		i += size
+	}
+	return false
+}
@@ -62,6 +62,11 @@ type Logger struct {
 	flag   int        // properties
 	out    io.Writer  // destination for output, 通过 io.Writer 进行解耦，让 Logger 既能够向 socket 输出，也能够向文件输出
 	buf    []byte     // for accumulating text to write，格式化时使用
+	level  Level      // minimum level of leveled records that are written
+	enc    Encoder    // formats each record; nil means the classic text layout
+
+	ctxKeys []ctxKey // context keys logged by the ...Ctx methods; copied on write
+	sampler *sampler // per call site sampling; nil means every record is written
 }
 
 // New creates a new Logger. The out variable sets the
@@ -78,6 +83,9 @@ func New(out io.Writer, prefix string, flag int) *Logger {
 func (l *Logger) SetOutput(w io.Writer) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if l.sampler != nil {
+		l.summarize(time.Now()) // to the old output
+	}
 	l.out = w
 }
 
@@ -103,6 +111,16 @@ func itoa(buf *[]byte, i int, wid int) {
 	*buf = append(*buf, b[bp:]...)
 }
 
+// shortFile returns the final element of the file name, as printed for Lshortfile.
+func shortFile(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
+
 // formatHeader writes log header to buf in following order:
 //   * l.prefix (if it's not blank and Lmsgprefix is unset),
 //   * date and/or time (if corresponding flags are provided),
@@ -147,14 +165,7 @@ func (l *Logger) formatHeader(buf *[]byte, t time.Time, file string, line int) {
 	/* 文件名、行号 */
 	if l.flag&(Lshortfile|Llongfile) != 0 {
 		if l.flag&Lshortfile != 0 {
-			short := file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i+1:]
-					break
-				}
-			}
-			file = short
+			file = shortFile(file)
 		}
 		*buf = append(*buf, file...)
 		*buf = append(*buf, ':')
@@ -174,6 +185,28 @@ func (l *Logger) formatHeader(buf *[]byte, t time.Time, file string, line int) {
 // paths it will be 2.
 // 完成前缀、时间、追加换行、实际输出等工作；不需要理会 fmt 的事情
 func (l *Logger) Output(calldepth int, s string) error {
+	return l.output(calldepth+1, levelNone, s, nil) // +1 for this frame.
+}
+
+// output is the common path of Output and the leveled methods.
+// Records with a level below l.level are discarded before any
+// formatting is done. args holds the record's attributes as
+// alternating keys and values (or Attr values), see argsToAttr.
+func (l *Logger) output(calldepth int, lvl Level, s string, args []interface{}) error {
+	return l.record(calldepth+1, lvl, s, args, true) // +1 for this frame.
+}
+
+// outputFinal is Output for the records of Fatal and Panic. They are
+// never sampled: a Fatal record is the last word of the program, and a
+// Panic record may be repeated by a recover loop until it is the only
+// clue left.
+func (l *Logger) outputFinal(calldepth int, s string) error {
+	return l.record(calldepth+1, levelNone, s, nil, false) // +1 for this frame.
+}
+
+// record formats and writes a record, subject to the sampler if sample
+// is set.
+func (l *Logger) record(calldepth int, lvl Level, s string, args []interface{}, sample bool) error {
 	now := time.Now() // get this early.
 	var file string
 	var line int
@@ -181,35 +214,90 @@ func (l *Logger) Output(calldepth int, s string) error {
 	// 实际 write 是加锁的，所以不会有并发问题
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if l.flag&(Lshortfile|Llongfile) != 0 {
+	if lvl != levelNone && lvl < l.level {
+		return nil
+	}
+	var pc uintptr
+	if l.flag&(Lshortfile|Llongfile) != 0 || (sample && l.sampler != nil) {
 		// 临时释放锁，因为获取文件信息实在是太耗时了
 		// 这里基本都是操作函数内的临时变量，所以不锁也是可以的
 		// Release lock while getting caller info - it's expensive.
 		l.mu.Unlock()
 		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		pc, file, line, ok = runtime.Caller(calldepth)
 		if !ok {
 			file = "???"
 			line = 0
 		}
 		l.mu.Lock()
 	}
+	if sample && l.sampler != nil && !l.sample(now, pc, file, line) {
+		return nil
+	}
+	return l.emit(now, lvl, file, line, s, args)
+}
+
+// emit formats a record into l.buf and writes it to l.out.
+// It must be called with l.mu held.
+func (l *Logger) emit(now time.Time, lvl Level, file string, line int, s string, args []interface{}) error {
 	l.buf = l.buf[:0] // reset
 
+	if l.enc != nil {
+		// 结构化输出：整条记录交给 encoder，依旧复用 l.buf
+		r := Record{Time: now, File: file, Line: line, Prefix: l.prefix, Level: lvl, Message: s, args: args}
+		l.buf = l.enc.AppendRecord(l.buf, l.flag, r)
+		l.buf = append(l.buf, '\n')
+		_, err := l.out.Write(l.buf)
+		return err
+	}
+
 	/* Header */
 	l.formatHeader(&l.buf, now, file, line) // 直接让底层操作当前的 slice
 
-	/* 实际内容 */
-	l.buf = append(l.buf, s...) // 避免生成新的 slice 对象
+	/* Level */
+	if lvl != levelNone {
+		l.buf = append(l.buf, lvl.String()...)
+		l.buf = append(l.buf, ' ')
+	}
 
-	/* 追加换行 */
-	if len(s) == 0 || s[len(s)-1] != '\n' {
+	/* 实际内容 */
+	if len(args) > 0 {
+		// attributes follow the message on the same line
+		if len(s) > 0 && s[len(s)-1] == '\n' {
+			s = s[:len(s)-1]
+		}
+		l.buf = append(l.buf, s...)
+		appendAttrs(&l.buf, args)
 		l.buf = append(l.buf, '\n')
+	} else {
+		l.buf = append(l.buf, s...) // 避免生成新的 slice 对象
+
+		/* 追加换行 */
+		if len(s) == 0 || s[len(s)-1] != '\n' {
+			l.buf = append(l.buf, '\n')
+		}
 	}
 	_, err := l.out.Write(l.buf) // 实际输出
 	return err
 }
 
+// Debug logs msg and the key/value pairs in args at LevelDebug.
+// Each element of args is either an Attr or a string key followed by
+// its value. The record is dropped if LevelDebug is below the Logger's level.
+func (l *Logger) Debug(msg string, args ...interface{}) { l.output(2, LevelDebug, msg, args) }
+
+// Info logs msg and the key/value pairs in args at LevelInfo.
+// See Debug for the handling of args.
+func (l *Logger) Info(msg string, args ...interface{}) { l.output(2, LevelInfo, msg, args) }
+
+// Warn logs msg and the key/value pairs in args at LevelWarn.
+// See Debug for the handling of args.
+func (l *Logger) Warn(msg string, args ...interface{}) { l.output(2, LevelWarn, msg, args) }
+
+// Error logs msg and the key/value pairs in args at LevelError.
+// See Debug for the handling of args.
+func (l *Logger) Error(msg string, args ...interface{}) { l.output(2, LevelError, msg, args) }
+
 // step 1: 然后利用 fmt.Sprint 来完成字符串的格式化（完成用户输出内容的处理）
 // step 2: 在 Logger 这一层完成 log 的格式化
 // Printf calls l.Output to print to the logger.
@@ -228,43 +316,66 @@ func (l *Logger) Println(v ...interface{}) { l.Output(2, fmt.Sprintln(v...)) }
 
 // Fatal is equivalent to l.Print() followed by a call to os.Exit(1).
 func (l *Logger) Fatal(v ...interface{}) {
-	l.Output(2, fmt.Sprint(v...))
+	l.outputFinal(2, fmt.Sprint(v...))
+	l.flush()
 	os.Exit(1)
 }
 
 // Fatalf is equivalent to l.Printf() followed by a call to os.Exit(1).
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-	l.Output(2, fmt.Sprintf(format, v...))
+	l.outputFinal(2, fmt.Sprintf(format, v...))
+	l.flush()
 	os.Exit(1)
 }
 
 // Fatalln is equivalent to l.Println() followed by a call to os.Exit(1).
 func (l *Logger) Fatalln(v ...interface{}) {
-	l.Output(2, fmt.Sprintln(v...))
+	l.outputFinal(2, fmt.Sprintln(v...))
+	l.flush()
 	os.Exit(1)
 }
 
 // Panic is equivalent to l.Print() followed by a call to panic().
 func (l *Logger) Panic(v ...interface{}) {
 	s := fmt.Sprint(v...)
-	l.Output(2, s)
+	l.outputFinal(2, s)
 	panic(s)
 }
 
 // Panicf is equivalent to l.Printf() followed by a call to panic().
 func (l *Logger) Panicf(format string, v ...interface{}) {
 	s := fmt.Sprintf(format, v...)
-	l.Output(2, s)
+	l.outputFinal(2, s)
 	panic(s)
 }
 
 // Panicln is equivalent to l.Println() followed by a call to panic().
 func (l *Logger) Panicln(v ...interface{}) {
 	s := fmt.Sprintln(v...)
-	l.Output(2, s)
+	l.outputFinal(2, s)
 	panic(s)
 }
 
+// flusher is implemented by outputs that buffer data, such as
+// AsyncWriter and bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// flush writes the pending sampling summary and flushes the output if
+// it buffers data. The Fatal functions call it so that the summary and
+// the records queued by an AsyncWriter are not lost on os.Exit.
+func (l *Logger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sampler != nil {
+		l.summarize(time.Now())
+	}
+	if f, ok := l.out.(flusher); ok {
+		f.Flush()
+	}
+}
+
 // Flags returns the output flags for the logger.
 // The flag bits are Ldate, Ltime, and so on.
 func (l *Logger) Flags() int {
@@ -295,6 +406,38 @@ func (l *Logger) SetPrefix(prefix string) {
 	l.prefix = prefix
 }
 
+// Level returns the minimum level of leveled records written by the logger.
+func (l *Logger) Level() Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+// SetLevel sets the minimum level of leveled records written by the logger.
+// Records logged with Debug, Info, Warn or Error below lvl are discarded.
+// Print, Fatal and Panic output is not affected.
+func (l *Logger) SetLevel(lvl Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = lvl
+}
+
+// Encoder returns the encoder used by the logger, or nil if the
+// logger writes the classic text layout.
+func (l *Logger) Encoder() Encoder {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc
+}
+
+// SetEncoder sets the encoder used to format each record.
+// A nil enc restores the classic text layout.
+func (l *Logger) SetEncoder(enc Encoder) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc = enc
+}
+
 // Writer returns the output destination for the logger.
 func (l *Logger) Writer() io.Writer {
 	l.mu.Lock()
@@ -331,6 +474,22 @@ func SetPrefix(prefix string) {
 	std.SetPrefix(prefix)
 }
 
+// SetLevel sets the minimum level of leveled records written by the standard logger.
+func SetLevel(lvl Level) {
+	std.SetLevel(lvl)
+}
+
+// SetEncoder sets the encoder used by the standard logger.
+func SetEncoder(enc Encoder) {
+	std.SetEncoder(enc)
+}
+
+// SetSampling sets per call site sampling for the standard logger.
+// See Logger.SetSampling.
+func SetSampling(first, thereafter int) {
+	std.SetSampling(first, thereafter)
+}
+
 // Writer returns the output destination for the standard logger.
 func Writer() io.Writer {
 	return std.Writer()
@@ -356,42 +515,69 @@ func Println(v ...interface{}) {
 	std.Output(2, fmt.Sprintln(v...))
 }
 
+// Debug logs msg and args at LevelDebug to the standard logger.
+// See Logger.Debug for the handling of args.
+func Debug(msg string, args ...interface{}) {
+	std.output(2, LevelDebug, msg, args)
+}
+
+// Info logs msg and args at LevelInfo to the standard logger.
+// See Logger.Debug for the handling of args.
+func Info(msg string, args ...interface{}) {
+	std.output(2, LevelInfo, msg, args)
+}
+
+// Warn logs msg and args at LevelWarn to the standard logger.
+// See Logger.Debug for the handling of args.
+func Warn(msg string, args ...interface{}) {
+	std.output(2, LevelWarn, msg, args)
+}
+
+// Error logs msg and args at LevelError to the standard logger.
+// See Logger.Debug for the handling of args.
+func Error(msg string, args ...interface{}) {
+	std.output(2, LevelError, msg, args)
+}
+
 // Fatal is equivalent to Print() followed by a call to os.Exit(1).
 func Fatal(v ...interface{}) {
-	std.Output(2, fmt.Sprint(v...))
+	std.outputFinal(2, fmt.Sprint(v...))
+	std.flush()
 	os.Exit(1)
 }
 
 // Fatalf is equivalent to Printf() followed by a call to os.Exit(1).
 func Fatalf(format string, v ...interface{}) {
-	std.Output(2, fmt.Sprintf(format, v...))
+	std.outputFinal(2, fmt.Sprintf(format, v...))
+	std.flush()
 	os.Exit(1)
 }
 
 // Fatalln is equivalent to Println() followed by a call to os.Exit(1).
 func Fatalln(v ...interface{}) {
-	std.Output(2, fmt.Sprintln(v...))
+	std.outputFinal(2, fmt.Sprintln(v...))
+	std.flush()
 	os.Exit(1)
 }
 
 // Panic is equivalent to Print() followed by a call to panic().
 func Panic(v ...interface{}) {
 	s := fmt.Sprint(v...)
-	std.Output(2, s)
+	std.outputFinal(2, s)
 	panic(s)
 }
 
 // Panicf is equivalent to Printf() followed by a call to panic().
 func Panicf(format string, v ...interface{}) {
 	s := fmt.Sprintf(format, v...)
-	std.Output(2, s)
+	std.outputFinal(2, s)
 	panic(s)
 }
 
 // Panicln is equivalent to Println() followed by a call to panic().
 func Panicln(v ...interface{}) {
 	s := fmt.Sprintln(v...)
-	std.Output(2, s)
+	std.outputFinal(2, s)
 	panic(s)
 }
 
@@ -179,6 +179,129 @@ func TestEmptyPrintCreatesLine(t *testing.T) {
 	}
 }
 
+func TestLevel(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "Test:", 0)
+	l.SetLevel(LevelInfo)
+	l.Debug("hidden")
+	l.Info("hello", "user", "gopher", "n", 3)
+	l.Warn("quoted", Attr{"msg", "a b"}, "k", "")
+	l.Error("odd", "dangling")
+	l.Print("always")
+	want := "Test:INFO hello user=gopher n=3\n" +
+		"Test:WARN quoted msg=\"a b\" k=\"\"\n" +
+		"Test:ERROR odd !BADKEY=dangling\n" +
+		"Test:always\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if lv := l.Level(); lv != LevelInfo {
+		t.Errorf("Level: expected %v got %v", LevelInfo, lv)
+	}
+}
+
+type ptrError struct{ s string }
+
+func (e *ptrError) Error() string { return e.s }
+
+type ptrStringer struct{ s string }
+
+func (s *ptrStringer) String() string { return s.s }
+
+func TestLevelNilValues(t *testing.T) {
+	var err *ptrError
+	var str *ptrStringer
+	tests := []struct {
+		enc  Encoder
+		want string
+	}{
+		{nil, "INFO nil err=<nil> str=<nil> ok=boom\n"},
+		{JSONEncoder{}, `{"level":"INFO","msg":"nil","err":"<nil>","str":"<nil>","ok":"boom"}` + "\n"},
+		{LogfmtEncoder{}, `level=INFO msg=nil err=<nil> str=<nil> ok=boom` + "\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		l := New(&b, "", 0)
+		if tt.enc != nil {
+			l.SetEncoder(tt.enc)
+		}
+		l.Info("nil", "err", err, "str", str, "ok", &ptrError{"boom"})
+		if got := b.String(); got != tt.want {
+			t.Errorf("%T: got %q; want %q", tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestLevelMsgprefix(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "XXX ", Lshortfile|Lmsgprefix)
+	l.Info("hello")
+	pattern := "^" + `[A-Za-z0-9_\-]+\.go:[0-9]+: ` + "XXX INFO hello\n$"
+	matched, err := regexp.MatchString(pattern, b.String())
+	if err != nil {
+		t.Fatalf("pattern %q did not compile: %s", pattern, err)
+	}
+	if !matched {
+		t.Errorf("log output should match %q is %q", pattern, b.String())
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	tests := []struct {
+		enc  Encoder
+		want string
+	}{
+		{JSONEncoder{}, `{"level":"WARN","prefix":"app","msg":"disk \"sda\"\tfull","pct":97.5,"ok":false,"err":null}` + "\n" +
+			`{"prefix":"app","msg":"plain"}` + "\n"},
+		{LogfmtEncoder{}, `level=WARN prefix=app msg="disk \"sda\"\tfull" pct=97.5 ok=false err=<nil>` + "\n" +
+			`prefix=app msg=plain` + "\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		l := New(&b, "app", 0)
+		l.SetEncoder(tt.enc)
+		l.Warn("disk \"sda\"\tfull", "pct", 97.5, "ok", false, "err", nil)
+		l.Println("plain")
+		if got := b.String(); got != tt.want {
+			t.Errorf("%T: got %q; want %q", tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestEncoderReservedKeys(t *testing.T) {
+	tests := []struct {
+		enc  Encoder
+		want string
+	}{
+		{JSONEncoder{}, `{"level":"INFO","msg":"real","attr.msg":"fake","attr.level":"x","attr.time":1,"msgs":2}` + "\n"},
+		{LogfmtEncoder{}, `level=INFO msg=real attr.msg=fake attr.level=x attr.time=1 msgs=2` + "\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		l := New(&b, "", 0)
+		l.SetEncoder(tt.enc)
+		l.Info("real", "msg", "fake", "level", "x", "time", 1, "msgs", 2)
+		if got := b.String(); got != tt.want {
+			t.Errorf("%T: got %q; want %q", tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestJSONEncoderHeader(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "", Ldate|Ltime|Lmicroseconds|LUTC|Lshortfile)
+	l.SetEncoder(JSONEncoder{})
+	l.Info("hello")
+	pattern := `^\{"time":"[0-9]{4}-[0-9]{2}-[0-9]{2}T` + Rtime + Rmicroseconds + `Z","level":"INFO","file":"[A-Za-z0-9_\-]+\.go:[0-9]+","msg":"hello"\}\n$`
+	matched, err := regexp.MatchString(pattern, b.String())
+	if err != nil {
+		t.Fatalf("pattern %q did not compile: %s", pattern, err)
+	}
+	if !matched {
+		t.Errorf("log output should match %q is %q", pattern, b.String())
+	}
+}
+
 func BenchmarkItoa(b *testing.B) {
 	dst := make([]byte, 0, 64)
 	for i := 0; i < b.N; i++ {
@@ -203,6 +326,17 @@ func BenchmarkPrintln(b *testing.B) {
 	}
 }
 
+func BenchmarkJSONEncoder(b *testing.B) {
+	const testString = "test"
+	var buf bytes.Buffer
+	l := New(&buf, "", LstdFlags)
+	l.SetEncoder(JSONEncoder{})
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		l.Info(testString, "n", i)
+	}
+}
+
 func BenchmarkPrintlnNoFlags(b *testing.B) {
 	const testString = "test"
 	var buf bytes.Buffer
@@ -0,0 +1,328 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A RotateWriter is an io.Writer that writes to a file and rotates it
+// once it grows past MaxSize bytes or once the current Interval of wall
+// clock time has elapsed. On rotation the current file is moved aside and
+// a fresh one is opened at once; a background goroutine then gzips the old
+// file to Filename.1.gz, shifting older backups to Filename.2.gz and so
+// on, and keeps at most MaxBackups of them. A file that fails to compress
+// is left uncompressed under its temporary name and retried after the
+// files rotated later, at the next rotation; the error is reported by
+// Close, not by Write. Files left under a temporary name by a process
+// that exited before compressing them are picked up when the writer
+// first opens Filename.
+//
+// A RotateWriter can be used simultaneously from multiple goroutines.
+// Used as the output of a Logger, rotation happens inside Write, that is
+// while the Logger holds its mutex, so no line is ever split or lost
+// across files. Reopen supports external rotation tools: after they have
+// moved the file away, Reopen makes the writer continue in a fresh file.
+//
+// 替代 logrotate + copytruncate：copytruncate 在 copy 与 truncate 之间写入的日志会丢失
+type RotateWriter struct {
+	Filename   string        // file to write to; backups live next to it
+	MaxSize    int64         // rotate before a write would exceed this many bytes; 0 means no limit
+	Interval   time.Duration // rotate at each multiple of Interval; 0 means never
+	MaxBackups int           // number of compressed backups to keep; 0 keeps none
+
+	mu      sync.Mutex // guards the following
+	file    *os.File
+	size    int64         // bytes written to file so far
+	next    time.Time     // time of the next interval rotation
+	pending []string      // rotated files waiting for compression, oldest first
+	zdone   chan struct{} // closed when the running compression ends; nil if none
+	zerr    error         // last compression error, reported by Close
+	scanned bool          // leftovers of an earlier process were looked for
+}
+
+// NewRotateWriter opens filename for appending and returns a RotateWriter
+// writing to it. See RotateWriter for the meaning of the other arguments.
+func NewRotateWriter(filename string, maxSize int64, interval time.Duration, maxBackups int) (*RotateWriter, error) {
+	w := &RotateWriter{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		Interval:   interval,
+		MaxBackups: maxBackups,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes p to the current file, rotating it first if needed.
+// A record is never split between two files.
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.needRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file immediately, regardless of size and interval.
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Reopen closes the current file and opens Filename again, creating it
+// if necessary. It is meant to be called from a SIGHUP handler after an
+// external tool has renamed the file.
+func (w *RotateWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Close closes the current file and waits for a background compression
+// to finish. It returns the error of a failed compression if there is no
+// other error to report. A later Write reopens the file.
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	err := w.closeFile()
+	done := w.zdone
+	w.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		err = w.zerr
+	}
+	w.zerr = nil
+	return err
+}
+
+// needRotate reports whether writing n more bytes requires a rotation.
+// It must be called with w.mu held.
+func (w *RotateWriter) needRotate(n int64) bool {
+	if w.MaxSize > 0 && w.size > 0 && w.size+n > w.MaxSize {
+		return true
+	}
+	return w.Interval > 0 && !time.Now().Before(w.next)
+}
+
+// open opens (or creates) Filename for appending.
+// It must be called with w.mu held.
+func (w *RotateWriter) open() error {
+	f, err := os.OpenFile(w.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = fi.Size()
+	if w.Interval > 0 {
+		w.next = time.Now().Truncate(w.Interval).Add(w.Interval)
+	}
+	if !w.scanned {
+		w.scanned = true
+		w.pending = append(w.pending, w.leftovers()...)
+		w.startCompress()
+	}
+	return nil
+}
+
+// leftovers returns the rotated files that an earlier process left
+// uncompressed, oldest first.
+func (w *RotateWriter) leftovers() []string {
+	dir, base := filepath.Split(w.Filename)
+	prefix := base + ".rotated."
+	ents, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range ents { // sorted by name, so by rotation time
+		n := e.Name()
+		if e.IsDir() || !strings.HasPrefix(n, prefix) || strings.HasSuffix(n, ".gz") {
+			continue
+		}
+		names = append(names, filepath.Join(dir, n))
+	}
+	return names
+}
+
+// closeFile closes the current file, if any.
+// It must be called with w.mu held.
+func (w *RotateWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate closes the current file, moves it aside for compression and
+// opens a fresh one.
+// It must be called with w.mu held.
+func (w *RotateWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	if w.MaxBackups <= 0 {
+		if err := os.Remove(w.Filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return w.open()
+	}
+
+	// move the file away first so the fresh file can be opened at once;
+	// the name is unique so that a file still waiting for compression,
+	// or left over by a failed one, is never overwritten
+	base := w.Filename + ".rotated." + strconv.FormatInt(time.Now().UnixNano(), 10)
+	tmp := base
+	for i := 1; exists(tmp); i++ {
+		tmp = base + "-" + strconv.Itoa(i)
+	}
+	if err := os.Rename(w.Filename, tmp); err == nil {
+		w.pending = append(w.pending, tmp)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.startCompress()
+	return nil
+}
+
+// startCompress starts compressing the pending files unless that is
+// already running.
+// It must be called with w.mu held.
+func (w *RotateWriter) startCompress() {
+	if w.zdone == nil && len(w.pending) > 0 {
+		w.zdone = make(chan struct{})
+		go w.compress(w.zdone)
+	}
+}
+
+// compress turns the pending files into backups, oldest first, without
+// holding w.mu while it copies, so that Write is never held up by gzip.
+// A file that fails goes to the back of w.pending, so that it does not
+// hold up the files behind it, and is retried at the next rotation.
+func (w *RotateWriter) compress(done chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var failed []string
+	for len(w.pending) > 0 {
+		tmp, max := w.pending[0], w.MaxBackups
+		w.pending = w.pending[1:]
+		w.mu.Unlock()
+		err := w.backup(tmp, max)
+		w.mu.Lock()
+		if err != nil {
+			w.zerr = err
+			failed = append(failed, tmp)
+		}
+	}
+	w.pending = failed
+	w.zdone = nil
+	close(done)
+}
+
+// backup gzips tmp and makes it backup number 1, shifting the older
+// backups up and dropping those beyond max. The backups are only
+// shifted once the compressed file is complete.
+func (w *RotateWriter) backup(tmp string, max int) error {
+	if !exists(tmp) {
+		return nil // removed by someone else
+	}
+	if max <= 0 {
+		return os.Remove(tmp)
+	}
+	if err := compressFile(tmp, tmp+".gz"); err != nil {
+		return err
+	}
+
+	// shift Filename.k.gz to Filename.k+1.gz, dropping the oldest
+	os.Remove(w.backupName(max))
+	for i := max - 1; i >= 1; i-- {
+		if err := os.Rename(w.backupName(i), w.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp + ".gz")
+			return err
+		}
+	}
+	if err := os.Rename(tmp+".gz", w.backupName(1)); err != nil {
+		os.Remove(tmp + ".gz")
+		return err
+	}
+	return os.Remove(tmp)
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return !os.IsNotExist(err)
+}
+
+func (w *RotateWriter) backupName(i int) string {
+	return w.Filename + "." + strconv.Itoa(i) + ".gz"
+}
+
+// compressFile gzips src into dst.
+func compressFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,199 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readGzip(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotateWriterSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotateWriter(name, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l := New(w, "", 0)
+	for _, s := range []string{"first", "second", "third", "fourth"} {
+		l.Print(s)
+	}
+	if err := w.Close(); err != nil { // waits for the compression
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(name); string(b) != "fourth\n" {
+		t.Errorf("current file = %q; want %q", b, "fourth\n")
+	}
+	if got := readGzip(t, name+".1.gz"); got != "third\n" {
+		t.Errorf("backup 1 = %q; want %q", got, "third\n")
+	}
+	if got := readGzip(t, name+".2.gz"); got != "second\n" {
+		t.Errorf("backup 2 = %q; want %q", got, "second\n")
+	}
+	if _, err := os.Stat(name + ".3.gz"); !os.IsNotExist(err) {
+		t.Errorf("backup 3 should not exist, Stat returned %v", err)
+	}
+}
+
+func TestRotateWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w, err := NewRotateWriter(name, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("old\n"))
+
+	// simulate logrotate moving the file away
+	if err := os.Rename(name, filepath.Join(dir, "moved.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("new\n"))
+
+	if b, _ := os.ReadFile(name); string(b) != "new\n" {
+		t.Errorf("reopened file = %q; want %q", b, "new\n")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "moved.log")); string(b) != "old\n" {
+		t.Errorf("moved file = %q; want %q", b, "old\n")
+	}
+}
+
+func TestRotateWriterCompressError(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	// a non-empty directory in the place of the backup makes it fail
+	if err := os.MkdirAll(filepath.Join(name+".1.gz", "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewRotateWriter(name, 10, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(w, "", 0)
+	l.Print("first")
+	if _, err := w.Write([]byte("second\n")); err != nil {
+		t.Fatalf("Write failed because of the compression: %v", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close did not report the compression error")
+	}
+	if b, _ := os.ReadFile(name); string(b) != "second\n" {
+		t.Errorf("current file = %q; want %q", b, "second\n")
+	}
+	left, _ := filepath.Glob(name + ".rotated.*")
+	if len(left) != 1 {
+		t.Fatalf("rotated files left = %q; want one", left)
+	}
+	if b, _ := os.ReadFile(left[0]); string(b) != "first\n" {
+		t.Errorf("uncompressed backup = %q; want %q", b, "first\n")
+	}
+
+	// the next rotation retries it
+	if err := os.RemoveAll(name + ".1.gz"); err != nil {
+		t.Fatal(err)
+	}
+	w.MaxBackups = 2
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGzip(t, name+".2.gz"); got != "first\n" {
+		t.Errorf("backup 2 = %q; want %q", got, "first\n")
+	}
+	if got := readGzip(t, name+".1.gz"); got != "second\n" {
+		t.Errorf("backup 1 = %q; want %q", got, "second\n")
+	}
+	if left, _ := filepath.Glob(name + ".rotated.*"); len(left) != 0 {
+		t.Errorf("rotated files left = %q", left)
+	}
+}
+
+func TestRotateWriterLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	// left by a process that exited before compressing them
+	for _, f := range []struct{ suffix, data string }{
+		{".rotated.100", "old\n"},
+		{".rotated.200", "older\n"}, // newer, despite its content
+		{".rotated.200.gz", "partial"},
+	} {
+		if err := os.WriteFile(name+f.suffix, []byte(f.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := NewRotateWriter(name, 0, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGzip(t, name+".1.gz"); got != "older\n" {
+		t.Errorf("backup 1 = %q; want %q", got, "older\n")
+	}
+	if got := readGzip(t, name+".2.gz"); got != "old\n" {
+		t.Errorf("backup 2 = %q; want %q", got, "old\n")
+	}
+	if left, _ := filepath.Glob(name + ".rotated.*"); len(left) != 0 {
+		t.Errorf("rotated files left = %q", left)
+	}
+}
+
+func TestRotateWriterFailedHead(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	// a dangling symlink cannot be opened, so it never compresses
+	bad := name + ".rotated.100"
+	if err := os.Symlink(filepath.Join(dir, "missing"), bad); err != nil {
+		t.Skip(err)
+	}
+	w, err := NewRotateWriter(name, 0, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close did not report the compression error")
+	}
+	if got := readGzip(t, name+".1.gz"); got != "hello\n" {
+		t.Errorf("backup 1 = %q; want %q", got, "hello\n")
+	}
+	if left, _ := filepath.Glob(name + ".rotated.*"); len(left) != 1 || left[0] != bad {
+		t.Errorf("rotated files left = %q; want only %q", left, bad)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"strconv"
+	"time"
+)
+
+// sampleTick is the length of a sampling window.
+const sampleTick = time.Second
+
+// A sampler limits the number of records written per call site.
+// It is guarded by the Logger's mutex.
+type sampler struct {
+	first      int
+	thereafter int
+
+	window time.Time       // start of the current window
+	index  map[uintptr]int // call site PC -> position in sites
+	sites  []sampleSite    // in order of first appearance within the window
+	timer  *time.Timer     // writes the summary at the end of the window; nil if nothing was suppressed
+}
+
+type sampleSite struct {
+	file       string
+	line       int
+	n          int // records seen in the current window
+	suppressed int
+}
+
+// SetSampling limits the records written per call site: in every second,
+// the first n records from a given call site are written, where n is
+// first, and after that only every thereafter-th one. If thereafter is 0,
+// all records past the first n are dropped. A first of 0 or less turns
+// sampling off.
+//
+// At the end of each second in which records were suppressed, the
+// logger writes a summary line for every call site that had records
+// suppressed, attributed to that call site's file and line. A pending
+// summary is also written by SetSampling, SetOutput and Fatal. The
+// records of Fatal and Panic are never suppressed.
+// 热点日志打爆磁盘时使用；复用 Lshortfile 的 runtime.Caller 结果来识别调用点
+func (l *Logger) SetSampling(first, thereafter int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sampler != nil {
+		l.summarize(time.Now())
+	}
+	if first <= 0 {
+		l.sampler = nil
+		return
+	}
+	if thereafter < 0 {
+		thereafter = 0
+	}
+	l.sampler = &sampler{
+		first:      first,
+		thereafter: thereafter,
+		index:      make(map[uintptr]int),
+	}
+}
+
+// sample reports whether the record logged at now from the call site pc
+// should be written. On the first record of a new window it writes the
+// summary lines for the previous one, unless the timer did already.
+// It must be called with l.mu held.
+func (l *Logger) sample(now time.Time, pc uintptr, file string, line int) bool {
+	sm := l.sampler
+	if !now.Truncate(sampleTick).Equal(sm.window) {
+		l.summarize(now)
+	}
+
+	i, ok := sm.index[pc]
+	if !ok {
+		i = len(sm.sites)
+		sm.index[pc] = i
+		sm.sites = append(sm.sites, sampleSite{file: file, line: line})
+	}
+	site := &sm.sites[i]
+	site.n++
+	if site.n <= sm.first {
+		return true
+	}
+	if sm.thereafter > 0 && (site.n-sm.first)%sm.thereafter == 0 {
+		return true
+	}
+	site.suppressed++
+	if sm.timer == nil {
+		// without it a flood followed by silence would never be reported
+		var t *time.Timer
+		t = time.AfterFunc(sm.window.Add(sampleTick).Sub(now), func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.sampler == sm && sm.timer == t { // not summarized since
+				l.summarize(time.Now())
+			}
+		})
+		sm.timer = t
+	}
+	return false
+}
+
+// summarize writes the summary lines for the call sites that had
+// records suppressed and starts a new window at now.
+// It must be called with l.mu held.
+func (l *Logger) summarize(now time.Time) {
+	sm := l.sampler
+	if sm.timer != nil {
+		sm.timer.Stop()
+		sm.timer = nil
+	}
+	sm.window = now.Truncate(sampleTick)
+	for i := range sm.sites {
+		site := &sm.sites[i]
+		if site.suppressed > 0 {
+			l.emit(now, levelNone, site.file, site.line,
+				"log: sampling suppressed "+strconv.Itoa(site.suppressed)+" records", nil)
+		}
+	}
+	// start from scratch so that the table does not grow without bound
+	sm.sites = sm.sites[:0]
+	for k := range sm.index {
+		delete(sm.index, k)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "", Lshortfile)
+	l.SetSampling(2, 3)
+
+	t0 := time.Date(2009, 1, 23, 1, 23, 23, 0, time.UTC)
+	var passed []int
+	l.mu.Lock()
+	for i := 1; i <= 10; i++ {
+		if l.sample(t0, 1, "/a/hot.go", 7) {
+			passed = append(passed, i)
+		}
+	}
+	if !l.sample(t0, 2, "/a/cold.go", 9) {
+		t.Error("first record of another call site was suppressed")
+	}
+	if b.Len() != 0 {
+		t.Errorf("summary written inside the window: %q", b.String())
+	}
+	// the next window reports the suppressed records and starts over
+	if !l.sample(t0.Add(time.Second), 1, "/a/hot.go", 7) {
+		t.Error("first record of a new window was suppressed")
+	}
+	l.mu.Unlock()
+
+	if want := []int{1, 2, 5, 8}; !equalInts(passed, want) {
+		t.Errorf("passed records %v; want %v", passed, want)
+	}
+	if got, want := b.String(), "hot.go:7: log: sampling suppressed 6 records\n"; got != want {
+		t.Errorf("summary = %q; want %q", got, want)
+	}
+}
+
+func TestSamplingOff(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "", 0)
+	l.SetSampling(1, 0)
+	l.SetSampling(0, 0)
+	for i := 0; i < 3; i++ {
+		l.Print("x")
+	}
+	if got := b.String(); got != "x\nx\nx\n" {
+		t.Errorf("got %q with sampling off", got)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that the sampling timer may write to
+// while the test reads it.
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestSamplingSummaryTimer(t *testing.T) {
+	var b lockedBuffer
+	l := New(&b, "", 0)
+	l.SetSampling(1, 0)
+	for i := 0; i < 5; i++ {
+		l.Print("flood")
+	}
+	// nothing is logged afterwards: the summary must come from the timer
+	deadline := time.Now().Add(3 * sampleTick)
+	for !strings.Contains(b.String(), "log: sampling suppressed") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no summary after the window ended; output %q", b.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the flood may straddle two windows
+	if n := strings.Count(b.String(), "flood\n"); n < 1 || n > 2 {
+		t.Errorf("%d records written; want 1 or 2", n)
+	}
+}
+
+func TestSamplingSummaryOnSetOutput(t *testing.T) {
+	var old, cur bytes.Buffer
+	l := New(&old, "", 0)
+	l.SetSampling(1, 0)
+	l.mu.Lock()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		l.sample(now, 1, "/a/hot.go", 7)
+	}
+	l.mu.Unlock()
+	l.SetOutput(&cur)
+	if got, want := old.String(), "log: sampling suppressed 2 records\n"; got != want {
+		t.Errorf("old output = %q; want %q", got, want)
+	}
+	if cur.Len() != 0 {
+		t.Errorf("new output = %q; want nothing", cur.String())
+	}
+}
+
+func TestSamplingPanicExempt(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "", 0)
+	l.SetSampling(1, 0)
+	for i := 0; i < 3; i++ {
+		func() {
+			defer func() { recover() }()
+			l.Panic("boom")
+		}()
+	}
+	if got := b.String(); got != "boom\nboom\nboom\n" {
+		t.Errorf("got %q; Panic records were sampled", got)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
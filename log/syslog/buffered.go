@@ -0,0 +1,238 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package syslog
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errClosed = errors.New("log/syslog: write to closed Writer")
+
+// Reconnect backoff and network timeout of a buffered Writer. Variables
+// so tests can shorten them.
+var (
+	minBackoff  = 100 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+	sendTimeout = 5 * time.Second // for each dial and write, and for the drain by Close
+)
+
+// WithBuffer makes the Writer non-blocking: messages are put in a queue
+// holding at most size messages and sent by a background goroutine, so
+// a log call never waits for the network or for a reconnect. When the
+// server is unreachable the goroutine reconnects with exponential backoff
+// and then replays the queue in order. When the queue is full the oldest
+// message is dropped. See Writer.Dropped and Writer.Queued.
+//
+// With WithBuffer, Dial does not connect: the goroutine makes the first
+// connection too, so Dial succeeds while the server is still down.
+//
+// The timestamp of a queued message is taken when it is sent.
+// 在 w.mu 锁内同步 reconnect 会把所有打日志的 goroutine 卡在 dial 上，所以改为后台发送
+func WithBuffer(size int) Option {
+	return func(w *Writer) {
+		if size <= 0 {
+			size = 1
+		}
+		w.queue = &sendQueue{max: size}
+	}
+}
+
+// A sendQueue holds the messages of a buffered Writer until they are sent.
+type sendQueue struct {
+	max int
+
+	mu       sync.Mutex
+	ready    sync.Cond // signaled when a message is queued or the queue is closed
+	msgs     []queuedMsg
+	inflight bool // the sender holds a message taken off msgs
+	dropped  uint64
+	closed   bool
+	drainBy  time.Time     // set by Close: deadline for sending what is left
+	closing  chan struct{} // closed by Close to cut a backoff short
+	done     chan struct{} // closed when the sender exits
+}
+
+type queuedMsg struct {
+	p     Priority
+	msgID string
+	sd    []SDElement
+	msg   string
+}
+
+// Dropped returns the number of messages discarded by a buffered Writer,
+// either because its queue was full or because they were still queued
+// and could not be sent when the Writer was closed.
+// It returns 0 for an unbuffered Writer.
+func (w *Writer) Dropped() uint64 {
+	if w.queue == nil {
+		return 0
+	}
+	w.queue.mu.Lock()
+	defer w.queue.mu.Unlock()
+	return w.queue.dropped
+}
+
+// Queued returns the number of messages waiting to be sent by a buffered
+// Writer. It returns 0 for an unbuffered Writer.
+func (w *Writer) Queued() int {
+	if w.queue == nil {
+		return 0
+	}
+	w.queue.mu.Lock()
+	defer w.queue.mu.Unlock()
+	n := len(w.queue.msgs)
+	if w.queue.inflight {
+		n++
+	}
+	return n
+}
+
+// startSender starts the background goroutine of a buffered Writer.
+func (w *Writer) startSender() {
+	q := w.queue
+	q.ready.L = &q.mu
+	q.closing = make(chan struct{})
+	q.done = make(chan struct{})
+	go w.send()
+}
+
+// enqueue queues a message, dropping the oldest one if the queue is full.
+func (w *Writer) enqueue(p Priority, msgID string, sd []SDElement, s string) (int, error) {
+	q := w.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, errClosed
+	}
+	if len(q.msgs) >= q.max {
+		q.msgs[0] = queuedMsg{}
+		q.msgs = q.msgs[1:]
+		q.dropped++
+	}
+	q.msgs = append(q.msgs, queuedMsg{p, msgID, sd, s})
+	q.ready.Signal()
+	return len(s), nil
+}
+
+// send is the background goroutine of a buffered Writer. It sends the
+// queued messages one at a time, reconnecting with backoff on failure.
+// The message being sent is taken off the queue first, so that it cannot
+// be dropped by enqueue while it is retried.
+func (w *Writer) send() {
+	q := w.queue
+	defer close(q.done)
+
+	// connect right away rather than with the first message; a failure
+	// is retried when there is something to send
+	w.mu.Lock()
+	if w.conn == nil {
+		w.connect()
+	}
+	w.mu.Unlock()
+
+	backoff := minBackoff
+	var m queuedMsg
+	for {
+		q.mu.Lock()
+		if !q.inflight {
+			for len(q.msgs) == 0 && !q.closed {
+				q.ready.Wait()
+			}
+			if len(q.msgs) == 0 {
+				q.mu.Unlock()
+				return
+			}
+			m = q.msgs[0]
+			q.msgs[0] = queuedMsg{}
+			q.msgs = q.msgs[1:]
+			q.inflight = true
+		}
+		closed, drainBy := q.closed, q.drainBy
+		q.mu.Unlock()
+
+		w.mu.Lock()
+		var err error
+		if w.conn == nil {
+			if closed {
+				err = errClosed // no reconnecting once Close has been called
+			} else {
+				err = w.connect()
+			}
+		}
+		if err == nil {
+			deadline := time.Now().Add(sendTimeout)
+			if closed && drainBy.Before(deadline) {
+				deadline = drainBy
+			}
+			setWriteDeadline(w.conn, deadline)
+			_, err = w.writeMsg(m.p, m.msgID, m.sd, m.msg)
+			if err != nil {
+				// drop the broken connection; the next round reconnects
+				w.conn.close()
+				w.conn = nil
+			}
+		}
+		w.mu.Unlock()
+
+		if err == nil {
+			backoff = minBackoff
+			q.mu.Lock()
+			q.inflight = false
+			q.mu.Unlock()
+			continue
+		}
+		if closed {
+			// no more retries once Close has been called
+			q.mu.Lock()
+			q.dropped += uint64(len(q.msgs)) + 1
+			q.msgs = nil
+			q.inflight = false
+			q.mu.Unlock()
+			return
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-q.closing:
+			t.Stop()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// setWriteDeadline sets the write deadline of c, if it is a network
+// connection, so that a stalled server cannot block the sender forever.
+func setWriteDeadline(c serverConn, t time.Time) {
+	if nc, ok := c.(*netConn); ok {
+		nc.conn.SetWriteDeadline(t)
+	}
+}
+
+// closeQueue stops accepting messages and waits for the sender to send
+// what it can of the queue over the current connection, for at most
+// sendTimeout.
+func (w *Writer) closeQueue() {
+	q := w.queue
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.done
+		return
+	}
+	q.closed = true
+	q.drainBy = time.Now().Add(sendTimeout)
+	close(q.closing)
+	q.ready.Signal()
+	q.mu.Unlock()
+	<-q.done
+}
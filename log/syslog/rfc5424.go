@@ -0,0 +1,151 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package syslog
+
+import (
+	"errors"
+	"strings"
+)
+
+// A Format is the layout of the messages sent by a Writer.
+type Format int
+
+const (
+	// RFC3164 is the legacy BSD layout:
+	//	<PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+	RFC3164 Format = iota
+
+	// RFC5424 is the layout of RFC 5424:
+	//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	// The tag is used as APP-NAME and the timestamp has microsecond precision.
+	RFC5424
+)
+
+// rfc5424Time is the TIMESTAMP layout of RFC 5424, section 6.2.3.
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+// nilValue is the RFC 5424 NILVALUE, used for empty header fields.
+const nilValue = "-"
+
+// An SDParam is a name/value pair of an SD-ELEMENT.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// An SDElement is an RFC 5424 STRUCTURED-DATA element, written as
+//
+//	[ID Name="Value" ...]
+//
+// IDs that are not registered with IANA should have the form name@number,
+// see RFC 5424, section 6.3.2.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// WriteStructured logs m with severity p (ignoring the severity passed
+// to New), the RFC 5424 MSGID msgID and the STRUCTURED-DATA elements sd.
+// An empty msgID is sent as the NILVALUE "-". Parameter values are
+// escaped as needed; IDs and parameter names that RFC 5424 does not
+// allow are reported as an error.
+// In the RFC3164 format msgID and sd are dropped.
+func (w *Writer) WriteStructured(p Priority, msgID string, sd []SDElement, m string) error {
+	for _, e := range sd {
+		if !validSDName(e.ID) {
+			return errors.New("log/syslog: invalid SD-ID " + e.ID)
+		}
+		for _, param := range e.Params {
+			if !validSDName(param.Name) {
+				return errors.New("log/syslog: invalid PARAM-NAME " + param.Name)
+			}
+		}
+	}
+	_, err := w.writeMsgAndRetry(p, msgID, sd, m)
+	return err
+}
+
+// rfc5424Body returns the part of an RFC 5424 message that follows PROCID:
+// "MSGID STRUCTURED-DATA MSG".
+func rfc5424Body(msgID string, sd []SDElement, msg string) string {
+	var b strings.Builder
+	b.WriteString(headerField(msgID, 32))
+	b.WriteByte(' ')
+	if len(sd) == 0 {
+		b.WriteString(nilValue)
+	}
+	for _, e := range sd {
+		b.WriteByte('[')
+		b.WriteString(e.ID)
+		for _, param := range e.Params {
+			b.WriteByte(' ')
+			b.WriteString(param.Name)
+			b.WriteString(`="`)
+			escapeParamValue(&b, param.Value)
+			b.WriteByte('"')
+		}
+		b.WriteByte(']')
+	}
+	if msg != "" {
+		b.WriteByte(' ')
+		b.WriteString(msg)
+	}
+	return b.String()
+}
+
+// escapeParamValue writes v with '"', '\' and ']' escaped by a backslash,
+// as required by RFC 5424, section 6.3.3.
+func escapeParamValue(b *strings.Builder, v string) {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// headerField returns s as an RFC 5424 header field: the NILVALUE if s is
+// empty, otherwise s with characters outside printable US-ASCII replaced
+// by '_' and truncated to max bytes.
+func headerField(s string, max int) string {
+	if s == "" {
+		return nilValue
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return strings.Map(func(r rune) rune {
+				if r < 33 || r > 126 {
+					return '_'
+				}
+				return r
+			}, s)
+		}
+	}
+	return s
+}
+
+// validSDName reports whether s is a valid SD-NAME: 1 to 32 printable
+// US-ASCII characters other than '=', ' ', ']' and '"'.
+func validSDName(s string) bool {
+	if len(s) == 0 || len(s) > 32 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
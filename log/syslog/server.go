@@ -0,0 +1,492 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Message is a syslog message as received by a Server.
+type Message struct {
+	Priority  Priority // facility | severity
+	Facility  Priority // Priority & facility bits, e.g. LOG_USER
+	Severity  Priority // Priority & severity bits, e.g. LOG_ERR
+	Format    Format   // RFC3164 or RFC5424
+	Timestamp time.Time
+	Hostname  string
+	Tag       string // TAG for RFC3164, APP-NAME for RFC5424
+	PID       int    // 0 if absent or not a number
+
+	// RFC5424 only.
+	MsgID          string
+	StructuredData []SDElement
+
+	Msg string // the free-form message, without trailing newline
+}
+
+// A Handler responds to a syslog message received by a Server.
+// ServeSyslog may be called concurrently for messages from different
+// connections.
+type Handler interface {
+	ServeSyslog(m *Message)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary
+// functions as syslog handlers.
+type HandlerFunc func(m *Message)
+
+// ServeSyslog calls f(m).
+func (f HandlerFunc) ServeSyslog(m *Message) { f(m) }
+
+// A Server receives syslog messages on a socket and hands them to its
+// Handler. Datagram sockets ("udp", "unixgram") carry one message per
+// datagram. On stream sockets ("tcp", "unix") each message is framed
+// either with a trailing newline or with RFC 6587 octet counting; both
+// are accepted on the same connection.
+// 主要用于集成测试与小型本地汇聚，格式兼容 writeString 产生的 BSD 格式与 RFC 5424
+type Server struct {
+	Handler  Handler
+	ErrorLog *log.Logger // logs malformed messages and accept errors; nil means discard
+
+	ln net.Listener   // for stream networks
+	pc net.PacketConn // for datagram networks
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup // active connections
+}
+
+var (
+	errNilHandler   = errors.New("syslog: nil Handler")
+	errNotListening = errors.New("syslog: Server is not listening; use Listen")
+)
+
+// maxFrame is the largest message accepted on a stream connection.
+// A client that sends more without a frame boundary is disconnected.
+const maxFrame = 1 << 20
+
+// Listen announces on the local network address and returns a Server
+// that hands received messages to h, which must not be nil. Call Serve
+// to start receiving. The network must be "udp", "udp4", "udp6",
+// "unixgram", "tcp", "tcp4", "tcp6" or "unix".
+func Listen(network, address string, h Handler) (*Server, error) {
+	if h == nil {
+		return nil, errNilHandler
+	}
+	s := &Server{Handler: h}
+	var err error
+	if isStream(network) {
+		s.ln, err = net.Listen(network, address)
+	} else {
+		s.pc, err = net.ListenPacket(network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Addr returns the address the server is listening on, or nil for a
+// Server not created by Listen.
+func (s *Server) Addr() net.Addr {
+	if s.ln != nil {
+		return s.ln.Addr()
+	}
+	if s.pc != nil {
+		return s.pc.LocalAddr()
+	}
+	return nil
+}
+
+// Serve receives messages until Close is called, then returns nil.
+// Other errors of the socket are logged and retried after a growing
+// delay, except that of a socket closed by other means, which stops the
+// server and is returned. Serve fails at once if the Server has no
+// Handler or was not created by Listen.
+func (s *Server) Serve() error {
+	if s.Handler == nil {
+		return errNilHandler
+	}
+	if s.pc != nil {
+		return s.servePacket()
+	}
+	if s.ln == nil {
+		return errNotListening
+	}
+	var delay time.Duration // how long to sleep on accept failure
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				s.wg.Wait()
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			delay = retryDelay(delay)
+			s.logf("syslog: accept error: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		if !s.track(c) {
+			c.Close()
+			continue
+		}
+		go s.serveConn(c)
+	}
+}
+
+// retryDelay returns the delay after a failed accept or read that
+// follows one of the given delay, doubling it from 5ms up to 1s as
+// net/http does.
+func retryDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	if delay *= 2; delay > time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
+// Close stops the server and closes all of its connections. It does
+// nothing on a Server that Listen did not create.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	if s.ln != nil {
+		return s.ln.Close()
+	}
+	if s.pc != nil {
+		return s.pc.Close()
+	}
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track records c as active. It reports false if the server is closed.
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) servePacket() error {
+	buf := make([]byte, 64<<10)
+	var delay time.Duration // how long to sleep on read failure
+	for {
+		n, _, err := s.pc.ReadFrom(buf)
+		if n > 0 {
+			s.handle(buf[:n])
+		}
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// e.g. an ICMP error reported for an earlier datagram
+			delay = retryDelay(delay)
+			s.logf("syslog: read error: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer s.untrack(c)
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		b, err := readFrame(r)
+		if len(b) > 0 {
+			s.handle(b)
+		}
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.logf("syslog: reading from %v: %v", c.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame reads one message from a stream. A frame starting with a
+// digit is octet counted (RFC 6587, section 3.4.1); anything else runs
+// up to the next newline. Either kind is at most maxFrame bytes long.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	c, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if c[0] < '0' || c[0] > '9' {
+		return readDelim(r, '\n', maxFrame)
+	}
+	count, err := readDelim(r, ' ', len(strconv.Itoa(maxFrame))+1)
+	if err != nil {
+		return nil, err
+	}
+	s := string(count)
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 || n > maxFrame {
+		return nil, errors.New("invalid octet count " + strconv.Quote(s))
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// readDelim is like r.ReadBytes(delim), but gives up with an error once
+// it has read max bytes without finding delim, so that a client cannot
+// make the server buffer an endless line.
+func readDelim(r *bufio.Reader, delim byte, max int) ([]byte, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice(delim)
+		if len(line)+len(frag) > max {
+			return nil, errors.New("frame longer than " + strconv.Itoa(max) + " bytes")
+		}
+		line = append(line, frag...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+func (s *Server) handle(b []byte) {
+	m, err := ParseMessage(b)
+	if err != nil {
+		s.logf("syslog: %v: %q", err, b)
+		return
+	}
+	s.Handler.ServeSyslog(m)
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	}
+}
+
+var errNoPriority = errors.New("missing <PRI>")
+
+// ParseMessage parses a single syslog message in either the RFC5424
+// format or the BSD format (RFC 3164) written by Writer, with or
+// without the hostname and with an RFC 3339 or a time.Stamp timestamp.
+func ParseMessage(b []byte) (*Message, error) {
+	b = bytes.TrimRight(b, "\r\n")
+	s := string(b)
+	if len(s) < 3 || s[0] != '<' {
+		return nil, errNoPriority
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return nil, errNoPriority
+	}
+	p, err := strconv.Atoi(s[1:end])
+	if err != nil || p < 0 || p > int(LOG_LOCAL7|LOG_DEBUG) {
+		return nil, errors.New("invalid priority " + strconv.Quote(s[1:end]))
+	}
+	m := &Message{
+		Priority: Priority(p),
+		Facility: Priority(p) & facilityMask,
+		Severity: Priority(p) & severityMask,
+	}
+	s = s[end+1:]
+	if strings.HasPrefix(s, "1 ") {
+		m.Format = RFC5424
+		if err := parse5424(m, s[2:]); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	m.Format = RFC3164
+	parse3164(m, s)
+	return m, nil
+}
+
+// parse3164 parses "TIMESTAMP [HOSTNAME] TAG[PID]: MSG". Being a
+// convention rather than a standard, missing pieces are not errors.
+func parse3164(m *Message, s string) {
+	if sp := strings.IndexByte(s, ' '); sp > 0 {
+		if t, err := time.Parse(time.RFC3339, s[:sp]); err == nil {
+			m.Timestamp = t
+			s = s[sp+1:]
+		}
+	}
+	if m.Timestamp.IsZero() && len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local); err == nil {
+			// time.Stamp has no year; assume the current one
+			m.Timestamp = t.AddDate(time.Now().Year(), 0, 0)
+			s = s[len(time.Stamp)+1:]
+		}
+	}
+
+	// the first word is the hostname unless it already looks like the tag
+	if sp := strings.IndexByte(s, ' '); sp > 0 {
+		if w := s[:sp]; !strings.HasSuffix(w, ":") && !strings.Contains(w, "[") {
+			m.Hostname = w
+			s = s[sp+1:]
+		}
+	}
+
+	colon := strings.Index(s, ": ")
+	if colon < 0 {
+		if strings.HasSuffix(s, ":") {
+			colon = len(s) - 1
+		} else {
+			m.Msg = s
+			return
+		}
+	}
+	tag := s[:colon]
+	if i := strings.IndexByte(tag, '['); i >= 0 && strings.HasSuffix(tag, "]") {
+		m.PID, _ = strconv.Atoi(tag[i+1 : len(tag)-1])
+		tag = tag[:i]
+	}
+	m.Tag = tag
+	if colon+2 <= len(s) {
+		m.Msg = s[colon+2:]
+	}
+}
+
+// parse5424 parses the part of an RFC 5424 message after "VERSION SP":
+// "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [SP MSG]".
+func parse5424(m *Message, s string) error {
+	var fields [5]string
+	for i := range fields {
+		sp := strings.IndexByte(s, ' ')
+		if sp < 0 {
+			return errors.New("truncated RFC 5424 header")
+		}
+		fields[i], s = s[:sp], s[sp+1:]
+	}
+	if fields[0] != nilValue {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return err
+		}
+		m.Timestamp = t
+	}
+	m.Hostname = unNil(fields[1])
+	m.Tag = unNil(fields[2])
+	m.PID, _ = strconv.Atoi(fields[3])
+	m.MsgID = unNil(fields[4])
+
+	var err error
+	if strings.HasPrefix(s, nilValue) {
+		s = s[len(nilValue):]
+	} else if m.StructuredData, s, err = parseSD(s); err != nil {
+		return err
+	}
+	if s == "" {
+		return nil
+	}
+	if s[0] != ' ' {
+		return errors.New("missing space after STRUCTURED-DATA")
+	}
+	m.Msg = strings.TrimPrefix(s[1:], "\ufeff") // optional BOM
+	return nil
+}
+
+func unNil(s string) string {
+	if s == nilValue {
+		return ""
+	}
+	return s
+}
+
+// parseSD parses one or more SD-ELEMENTs from the start of s and returns
+// them with the rest of s.
+func parseSD(s string) ([]SDElement, string, error) {
+	errSD := errors.New("malformed STRUCTURED-DATA")
+	var sd []SDElement
+	for len(s) > 0 && s[0] == '[' {
+		s = s[1:]
+		i := strings.IndexAny(s, " ]")
+		if i <= 0 {
+			return nil, "", errSD
+		}
+		e := SDElement{ID: s[:i]}
+		s = s[i:]
+		for len(s) > 0 && s[0] == ' ' {
+			s = s[1:]
+			eq := strings.IndexByte(s, '=')
+			if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+				return nil, "", errSD
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+			var v strings.Builder
+			for {
+				if len(s) == 0 {
+					return nil, "", errSD
+				}
+				c := s[0]
+				s = s[1:]
+				if c == '"' {
+					break
+				}
+				if c == '\\' && len(s) > 0 && (s[0] == '"' || s[0] == '\\' || s[0] == ']') {
+					c = s[0]
+					s = s[1:]
+				}
+				v.WriteByte(c)
+			}
+			e.Params = append(e.Params, SDParam{name, v.String()})
+		}
+		if len(s) == 0 || s[0] != ']' {
+			return nil, "", errSD
+		}
+		s = s[1:]
+		sd = append(sd, e)
+	}
+	if sd == nil {
+		return nil, "", errSD
+	}
+	return sd, s, nil
+}
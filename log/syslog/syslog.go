@@ -8,8 +8,10 @@
 package syslog
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -80,6 +82,10 @@ type Writer struct {
 	hostname string
 	network  string
 	raddr    string
+	format   Format
+	framing  Framing
+	tlsConf  *tls.Config // non-nil for RFC 5425 transport, see DialTLS
+	queue    *sendQueue  // non-nil in buffered mode, see WithBuffer
 
 	mu   sync.Mutex // guards conn
 	conn serverConn
@@ -97,8 +103,10 @@ type serverConn interface {
 }
 
 type netConn struct {
-	local bool
-	conn  net.Conn
+	local      bool
+	format     Format
+	octetCount bool // frame messages with RFC 6587 octet counting
+	conn       net.Conn
 }
 
 // New establishes a new connection to the system log daemon. Each
@@ -109,14 +117,73 @@ func New(priority Priority, tag string) (*Writer, error) {
 	return Dial("", "", priority, tag)
 }
 
+// An Option configures a Writer created by Dial.
+type Option func(*Writer)
+
+// WithFormat selects the message format written by the Writer.
+// The default is RFC3164.
+func WithFormat(f Format) Option {
+	return func(w *Writer) { w.format = f }
+}
+
+// A Framing is the way messages are delimited on stream transports,
+// see RFC 6587. It has no effect on datagram transports such as "udp"
+// and "unixgram", where each message is a datagram.
+type Framing int
+
+const (
+	// NonTransparentFraming terminates each message with a newline.
+	// A message that contains newlines is read back as several records.
+	NonTransparentFraming Framing = iota
+
+	// OctetCounting prefixes each message with its length in bytes
+	// and a space, so messages may contain newlines.
+	OctetCounting
+)
+
+// WithFraming selects the framing used on stream transports.
+// The default is NonTransparentFraming, except for DialTLS.
+func WithFraming(f Framing) Option {
+	return func(w *Writer) { w.framing = f }
+}
+
+// isStream reports whether network is a stream-oriented network.
+func isStream(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
 // Dial establishes a connection to a log daemon by connecting to
 // address raddr on the specified network. Each write to the returned
 // writer sends a log message with the facility and severity
 // (from priority) and tag. If tag is empty, the os.Args[0] is used.
 // If network is empty, Dial will connect to the local syslog server.
 // Otherwise, see the documentation for net.Dial for valid values
-// of network and raddr.
-func Dial(network, raddr string, priority Priority, tag string) (*Writer, error) {
+// of network and raddr. The opts further configure the Writer.
+func Dial(network, raddr string, priority Priority, tag string, opts ...Option) (*Writer, error) {
+	return dial(network, raddr, priority, tag, nil, opts)
+}
+
+// DialTLS is like Dial but connects over TLS using config, as described
+// in RFC 5425. The network must be a stream network such as "tcp".
+// Messages are framed with OctetCounting, as RFC 5425 requires; a
+// WithFraming option among opts overrides it. Like Dial, the Writer
+// reconnects and retries when a write fails.
+func DialTLS(network, raddr string, priority Priority, tag string, config *tls.Config, opts ...Option) (*Writer, error) {
+	if !isStream(network) || network == "" {
+		return nil, errors.New("log/syslog: DialTLS requires a stream network")
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	opts = append([]Option{WithFraming(OctetCounting)}, opts...)
+	return dial(network, raddr, priority, tag, config, opts)
+}
+
+func dial(network, raddr string, priority Priority, tag string, config *tls.Config, opts []Option) (*Writer, error) {
 	if priority < 0 || priority > LOG_LOCAL7|LOG_DEBUG {
 		return nil, errors.New("log/syslog: invalid priority")
 	}
@@ -132,6 +199,20 @@ func Dial(network, raddr string, priority Priority, tag string) (*Writer, error)
 		hostname: hostname,
 		network:  network,
 		raddr:    raddr,
+		tlsConf:  config,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.format != RFC3164 && w.format != RFC5424 {
+		return nil, errors.New("log/syslog: invalid format")
+	}
+
+	if w.queue != nil {
+		// the sender connects in the background, so that a server that
+		// is down at startup only delays the messages
+		w.startSender()
+		return w, nil
 	}
 
 	w.mu.Lock()
@@ -155,16 +236,29 @@ func (w *Writer) connect() (err error) {
 
 	if w.network == "" {
 		w.conn, err = unixSyslog()
+		if nc, ok := w.conn.(*netConn); ok {
+			nc.format = w.format
+		}
 		if w.hostname == "" {
 			w.hostname = "localhost"
 		}
 	} else {
 		var c net.Conn
-		c, err = net.Dial(w.network, w.raddr)
+		var d net.Dialer
+		if w.queue != nil {
+			d.Timeout = sendTimeout // Close waits for the sender
+		}
+		if w.tlsConf != nil {
+			c, err = tls.DialWithDialer(&d, w.network, w.raddr, w.tlsConf)
+		} else {
+			c, err = d.Dial(w.network, w.raddr)
+		}
 		if err == nil {
 			w.conn = &netConn{
-				conn:  c,
-				local: w.network == "unixgram" || w.network == "unix",
+				conn:       c,
+				local:      w.network == "unixgram" || w.network == "unix",
+				format:     w.format,
+				octetCount: w.framing == OctetCounting && isStream(w.network),
 			}
 			if w.hostname == "" {
 				w.hostname = c.LocalAddr().String()
@@ -180,7 +274,14 @@ func (w *Writer) Write(b []byte) (int, error) {
 }
 
 // Close closes a connection to the syslog daemon.
+// A buffered Writer first sends the queued messages it can over its
+// current connection, without reconnecting and for at most a few
+// seconds; the rest are counted as dropped.
 func (w *Writer) Close() error {
+	if w.queue != nil {
+		w.closeQueue()
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -249,32 +350,51 @@ func (w *Writer) Debug(m string) error {
 }
 
 func (w *Writer) writeAndRetry(p Priority, s string) (int, error) {
+	return w.writeMsgAndRetry(p, "", nil, s)
+}
+
+func (w *Writer) writeMsgAndRetry(p Priority, msgID string, sd []SDElement, s string) (int, error) {
 	pr := (w.priority & facilityMask) | (p & severityMask)
+	if w.queue != nil {
+		return w.enqueue(pr, msgID, sd, s)
+	}
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	if w.conn != nil {
-		if n, err := w.write(pr, s); err == nil {
+		if n, err := w.writeMsg(pr, msgID, sd, s); err == nil {
 			return n, err
 		}
 	}
 	if err := w.connect(); err != nil {
 		return 0, err
 	}
-	return w.write(pr, s)
+	return w.writeMsg(pr, msgID, sd, s)
 }
 
 // write generates and writes a syslog formatted string. The
 // format is as follows: <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+// or, with RFC5424, <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
 func (w *Writer) write(p Priority, msg string) (int, error) {
+	return w.writeMsg(p, "", nil, msg)
+}
+
+// writeMsg is like write, but also takes the MSGID and STRUCTURED-DATA
+// of an RFC 5424 message. They are ignored in the RFC3164 format.
+func (w *Writer) writeMsg(p Priority, msgID string, sd []SDElement, msg string) (int, error) {
 	// ensure it ends in a \n
 	nl := ""
 	if !strings.HasSuffix(msg, "\n") {
 		nl = "\n"
 	}
 
-	err := w.conn.writeString(p, w.hostname, w.tag, msg, nl)
+	s := msg
+	if w.format == RFC5424 {
+		// the conn writes the header up to PROCID, the rest is ours
+		s = rfc5424Body(msgID, sd, msg)
+	}
+	err := w.conn.writeString(p, w.hostname, w.tag, s, nl)
 	if err != nil {
 		return 0, err
 	}
@@ -285,18 +405,37 @@ func (w *Writer) write(p Priority, msg string) (int, error) {
 }
 
 func (n *netConn) writeString(p Priority, hostname, tag, msg, nl string) error {
+	if n.octetCount {
+		// RFC 6587 octet counting: MSG-LEN SP SYSLOG-MSG, with no trailer,
+		// so that multi-line messages stay a single record.
+		var b strings.Builder
+		n.fprint(&b, p, hostname, tag, msg, "")
+		_, err := fmt.Fprintf(n.conn, "%d %s", b.Len(), b.String())
+		return err
+	}
+	return n.fprint(n.conn, p, hostname, tag, msg, nl)
+}
+
+// fprint writes a syslog message in the connection's format to w.
+func (n *netConn) fprint(w io.Writer, p Priority, hostname, tag, msg, nl string) error {
+	if n.format == RFC5424 {
+		_, err := fmt.Fprintf(w, "<%d>1 %s %s %s %d %s%s",
+			p, time.Now().Format(rfc5424Time), headerField(hostname, 255),
+			headerField(tag, 48), os.Getpid(), msg, nl)
+		return err
+	}
 	if n.local {
 		// Compared to the network form below, the changes are:
 		//	1. Use time.Stamp instead of time.RFC3339.
 		//	2. Drop the hostname field from the Fprintf.
 		timestamp := time.Now().Format(time.Stamp)
-		_, err := fmt.Fprintf(n.conn, "<%d>%s %s[%d]: %s%s",
+		_, err := fmt.Fprintf(w, "<%d>%s %s[%d]: %s%s",
 			p, timestamp,
 			tag, os.Getpid(), msg, nl)
 		return err
 	}
 	timestamp := time.Now().Format(time.RFC3339)
-	_, err := fmt.Fprintf(n.conn, "<%d>%s %s %s[%d]: %s%s",
+	_, err := fmt.Fprintf(w, "<%d>%s %s %s[%d]: %s%s",
 		p, timestamp, hostname,
 		tag, os.Getpid(), msg, nl)
 	return err
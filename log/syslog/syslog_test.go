@@ -9,12 +9,23 @@ package syslog
 
 import (
 	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -412,3 +423,512 @@ func TestConcurrentReconnect(t *testing.T) {
 		t.Error("timeout in concurrent reconnect")
 	}
 }
+
+func TestRFC5424(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("Error retrieving hostname")
+	}
+	tests := []struct {
+		msgID string
+		sd    []SDElement
+		msg   string
+		exp   string
+	}{
+		{"ID47", []SDElement{{ID: "req@32473", Params: []SDParam{{"id", `a"b\c]d`}, {"user", "gopher"}}}}, "structured",
+			`ID47 [req@32473 id="a\"b\\c\]d" user="gopher"] structured` + "\n"},
+		{"", nil, "plain", "- - plain\n"},
+	}
+	for _, test := range tests {
+		done := make(chan string)
+		addr, sock, srvWG := startServer("udp", "", done)
+		w, err := Dial("udp", addr, LOG_USER|LOG_ERR, "syslog_test", WithFormat(RFC5424))
+		if err != nil {
+			t.Fatalf("syslog.Dial() failed: %v", err)
+		}
+		if err := w.WriteStructured(LOG_WARNING, test.msgID, test.sd, test.msg); err != nil {
+			t.Fatalf("WriteStructured() failed: %v", err)
+		}
+		rcvd := <-done
+		w.Close()
+		sock.Close()
+		srvWG.Wait()
+
+		var timestamp string
+		var pid int
+		head := fmt.Sprintf("<%d>1 %%s %s syslog_test %%d ", LOG_USER|LOG_WARNING, hostname)
+		if n, err := fmt.Sscanf(rcvd, head, &timestamp, &pid); n != 2 || err != nil {
+			t.Errorf("got %q, does not match template %q (%d %v)", rcvd, head, n, err)
+			continue
+		}
+		if _, err := time.Parse(rfc5424Time, timestamp); err != nil {
+			t.Errorf("bad timestamp %q: %v", timestamp, err)
+		}
+		if !strings.HasSuffix(rcvd, " "+test.exp) {
+			t.Errorf("got %q, want suffix %q", rcvd, test.exp)
+		}
+	}
+}
+
+func TestWriteStructuredInvalid(t *testing.T) {
+	w := &Writer{}
+	if err := w.WriteStructured(LOG_INFO, "", []SDElement{{ID: "bad id"}}, "x"); err == nil {
+		t.Error("WriteStructured accepted an SD-ID with a space")
+	}
+}
+
+// readOctetCounted reads one RFC 6587 octet-counted frame from r.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return string(b), err
+}
+
+func testOctetCounting(t *testing.T, l net.Listener, dial func(addr string) (*Writer, error)) {
+	defer l.Close()
+	rcvd := make(chan string, 2)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(rcvd)
+			return
+		}
+		defer c.Close()
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		br := bufio.NewReader(c)
+		for i := 0; i < 2; i++ {
+			s, err := readOctetCounted(br)
+			if err != nil {
+				break
+			}
+			rcvd <- s
+		}
+		close(rcvd)
+	}()
+
+	w, err := dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer w.Close()
+	msgs := []string{"panic: boom\n\ngoroutine 1 [running]:\nmain.main()", "second"}
+	for _, m := range msgs {
+		if err := w.Err(m); err != nil {
+			t.Fatalf("Err() failed: %v", err)
+		}
+	}
+	for _, m := range msgs {
+		s, ok := <-rcvd
+		if !ok {
+			t.Fatalf("frame for %q not received", m)
+		}
+		if !strings.HasSuffix(s, "syslog_test["+fmt.Sprint(os.Getpid())+"]: "+m) {
+			t.Errorf("got frame %q, want message %q", s, m)
+		}
+	}
+}
+
+func TestOctetCounting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOctetCounting(t, l, func(addr string) (*Writer, error) {
+		return Dial("tcp", addr, LOG_USER|LOG_ERR, "syslog_test", WithFraming(OctetCounting))
+	})
+}
+
+func TestDialTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOctetCounting(t, l, func(addr string) (*Writer, error) {
+		return DialTLS("tcp", addr, LOG_USER|LOG_ERR, "syslog_test", &tls.Config{RootCAs: pool})
+	})
+
+	if _, err := DialTLS("udp", "127.0.0.1:514", LOG_USER|LOG_ERR, "syslog_test", nil); err == nil {
+		t.Error("DialTLS accepted a datagram network")
+	}
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a
+// pool that trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"syslog test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestBufferedReconnect(t *testing.T) {
+	if !testableNetwork("unix") {
+		t.Skipf("skipping on %s/%s; 'unix' is not supported", runtime.GOOS, runtime.GOARCH)
+	}
+	defer func(d time.Duration) { minBackoff = d }(minBackoff)
+	minBackoff = time.Millisecond
+
+	f, err := os.CreateTemp("", "syslogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	addr := f.Name()
+	os.Remove(addr)
+	defer os.Remove(addr)
+
+	listen := func() (net.Listener, chan net.Conn) {
+		l, err := net.Listen("unix", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns := make(chan net.Conn, 1)
+		go func() {
+			if c, err := l.Accept(); err == nil {
+				conns <- c
+			}
+		}()
+		return l, conns
+	}
+	readLine := func(r *bufio.Reader) string {
+		s, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString: %v", err)
+		}
+		return s
+	}
+
+	l, conns := listen()
+	w, err := Dial("unix", addr, LOG_USER|LOG_ERR, "syslog_test", WithBuffer(2))
+	if err != nil {
+		t.Fatalf("syslog.Dial() failed: %v", err)
+	}
+	defer w.Close()
+	c := <-conns
+	w.Info("before")
+	if s := readLine(bufio.NewReader(c)); !strings.HasSuffix(s, ": before\n") {
+		t.Errorf("got %q before the outage", s)
+	}
+
+	// take the server down; log calls must not block
+	c.Close()
+	l.Close()
+	w.Info("a")
+	for {
+		w.queue.mu.Lock()
+		inflight := w.queue.inflight
+		w.queue.mu.Unlock()
+		if inflight {
+			break
+		}
+		runtime.Gosched()
+	}
+	for _, m := range []string{"b", "c", "d"} {
+		w.Info(m)
+	}
+	if n := w.Dropped(); n != 1 {
+		t.Errorf("Dropped() = %d; want 1", n)
+	}
+	if n := w.Queued(); n != 3 {
+		t.Errorf("Queued() = %d; want 3", n)
+	}
+
+	// bring it back; the queue is replayed in order
+	os.Remove(addr)
+	l, conns = listen()
+	defer l.Close()
+	c = <-conns
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	for _, m := range []string{"a", "c", "d"} {
+		if s := readLine(r); !strings.HasSuffix(s, ": "+m+"\n") {
+			t.Errorf("got %q, want message %q", s, m)
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	ts := time.Date(2009, 1, 23, 1, 23, 23, 123000000, time.UTC)
+	tests := []struct {
+		in   string
+		want Message
+	}{
+		{"<11>2009-01-23T01:23:23Z myhost app[42]: hello world\n", Message{
+			Priority: LOG_USER | LOG_ERR, Facility: LOG_USER, Severity: LOG_ERR, Format: RFC3164,
+			Timestamp: ts.Truncate(time.Second), Hostname: "myhost", Tag: "app", PID: 42, Msg: "hello world",
+		}},
+		{"<14>Jan 23 01:23:23 app[42]: local", Message{
+			Priority: LOG_USER | LOG_INFO, Facility: LOG_USER, Severity: LOG_INFO, Format: RFC3164,
+			Tag: "app", PID: 42, Msg: "local",
+		}},
+		{`<165>1 2009-01-23T01:23:23.123Z myhost app 42 ID47 [ex@32473 a="1" b="x\"y\]"][meta n="2"] msg`, Message{
+			Priority: LOG_LOCAL4 | LOG_NOTICE, Facility: LOG_LOCAL4, Severity: LOG_NOTICE, Format: RFC5424,
+			Timestamp: ts, Hostname: "myhost", Tag: "app", PID: 42, MsgID: "ID47",
+			StructuredData: []SDElement{
+				{ID: "ex@32473", Params: []SDParam{{"a", "1"}, {"b", `x"y]`}}},
+				{ID: "meta", Params: []SDParam{{"n", "2"}}},
+			},
+			Msg: "msg",
+		}},
+		{"<165>1 - - - - - -", Message{
+			Priority: LOG_LOCAL4 | LOG_NOTICE, Facility: LOG_LOCAL4, Severity: LOG_NOTICE, Format: RFC5424,
+		}},
+	}
+	for _, test := range tests {
+		m, err := ParseMessage([]byte(test.in))
+		if err != nil {
+			t.Errorf("ParseMessage(%q): %v", test.in, err)
+			continue
+		}
+		if test.want.Timestamp.IsZero() && test.want.Format == RFC3164 {
+			// time.Stamp carries no year or zone
+			if m.Timestamp.Month() != time.January || m.Timestamp.Day() != 23 {
+				t.Errorf("ParseMessage(%q): timestamp %v", test.in, m.Timestamp)
+			}
+			m.Timestamp = time.Time{}
+		}
+		if !m.Timestamp.Equal(test.want.Timestamp) {
+			t.Errorf("ParseMessage(%q): timestamp %v, want %v", test.in, m.Timestamp, test.want.Timestamp)
+		}
+		m.Timestamp, test.want.Timestamp = time.Time{}, time.Time{}
+		if fmt.Sprint(*m) != fmt.Sprint(test.want) {
+			t.Errorf("ParseMessage(%q):\n got %+v\nwant %+v", test.in, *m, test.want)
+		}
+	}
+
+	for _, in := range []string{"", "no priority", "<999>x", "<1>1 truncated", "<1>1 - - - - - [bad"} {
+		if _, err := ParseMessage([]byte(in)); err == nil {
+			t.Errorf("ParseMessage(%q) succeeded", in)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	for _, tr := range []string{"udp", "tcp", "unixgram", "unix"} {
+		if !testableNetwork(tr) {
+			continue
+		}
+		for _, format := range []Format{RFC3164, RFC5424} {
+			addr := "127.0.0.1:0"
+			if tr == "unix" || tr == "unixgram" {
+				f, err := os.CreateTemp("", "syslogtest")
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+				addr = f.Name()
+				os.Remove(addr)
+			}
+			msgs := make(chan *Message, 2)
+			srv, err := Listen(tr, addr, HandlerFunc(func(m *Message) { msgs <- m }))
+			if err != nil {
+				t.Fatalf("Listen(%q): %v", tr, err)
+			}
+			served := make(chan error, 1)
+			go func() { served <- srv.Serve() }()
+
+			opts := []Option{WithFormat(format)}
+			if isStream(tr) {
+				opts = append(opts, WithFraming(OctetCounting))
+			}
+			w, err := Dial(tr, srv.Addr().String(), LOG_DAEMON|LOG_WARNING, "syslog_test", opts...)
+			if err != nil {
+				t.Fatalf("Dial(%q): %v", tr, err)
+			}
+			w.Err("line 1\nline 2")
+			w.Close()
+
+			select {
+			case m := <-msgs:
+				if m.Priority != LOG_DAEMON|LOG_ERR || m.Tag != "syslog_test" || m.PID != os.Getpid() ||
+					m.Msg != "line 1\nline 2" || m.Format != format {
+					t.Errorf("%s/%d: got %+v", tr, format, m)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("%s/%d: no message received", tr, format)
+			}
+			srv.Close()
+			if err := <-served; err != nil {
+				t.Errorf("%s/%d: Serve returned %v", tr, format, err)
+			}
+			if tr == "unix" || tr == "unixgram" {
+				os.Remove(addr)
+			}
+		}
+	}
+}
+
+func TestReadFrameLimit(t *testing.T) {
+	long := strings.Repeat("x", maxFrame+1)
+	for _, in := range []string{
+		"<13>" + long + "\n", // no newline within the limit
+		long,                 // nor at all
+		"1" + long + " x",    // octet count that never ends
+	} {
+		r := bufio.NewReader(strings.NewReader(in))
+		if b, err := readFrame(r); err == nil || err == io.EOF {
+			t.Errorf("readFrame of %d bytes = %d bytes, %v; want a length error", len(in), len(b), err)
+		}
+	}
+
+	in := "<13>" + strings.Repeat("x", maxFrame-5) + "\n"
+	if b, err := readFrame(bufio.NewReader(strings.NewReader(in))); err != nil || len(b) != maxFrame {
+		t.Errorf("readFrame of a maximal frame = %d bytes, %v", len(b), err)
+	}
+	in = strconv.Itoa(maxFrame) + " " + strings.Repeat("x", maxFrame)
+	if b, err := readFrame(bufio.NewReader(strings.NewReader(in))); err != nil || len(b) != maxFrame {
+		t.Errorf("readFrame of a maximal counted frame = %d bytes, %v", len(b), err)
+	}
+}
+
+func TestServerNilHandler(t *testing.T) {
+	if _, err := Listen("udp", "127.0.0.1:0", nil); err == nil {
+		t.Error("Listen with a nil Handler succeeded")
+	}
+	srv, err := Listen("udp", "127.0.0.1:0", HandlerFunc(func(*Message) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.Handler = nil
+	if err := srv.Serve(); err == nil {
+		t.Error("Serve with a nil Handler succeeded")
+	}
+}
+
+func TestServerZero(t *testing.T) {
+	s := &Server{Handler: HandlerFunc(func(*Message) {})}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close of a zero Server = %v", err)
+	}
+	if a := s.Addr(); a != nil {
+		t.Errorf("Addr of a zero Server = %v", a)
+	}
+	if err := s.Serve(); err == nil {
+		t.Error("Serve of a zero Server succeeded")
+	}
+}
+
+// failingListener fails its Accepts with errs, in order.
+type failingListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, err
+}
+
+func TestServerAcceptError(t *testing.T) {
+	closed := &net.OpError{Op: "accept", Net: "tcp", Err: net.ErrClosed}
+	ln := &failingListener{errs: []error{errors.New("too many open files"), closed}}
+	s := &Server{Handler: HandlerFunc(func(*Message) {}), ln: ln}
+	if err := s.Serve(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Serve = %v; want the error of the closed listener", err)
+	}
+	if len(ln.errs) != 0 {
+		t.Errorf("Serve stopped at the first accept error")
+	}
+}
+
+func TestBufferedDialDown(t *testing.T) {
+	if !testableNetwork("unix") {
+		t.Skipf("skipping on %s/%s; 'unix' is not supported", runtime.GOOS, runtime.GOARCH)
+	}
+	defer func(d time.Duration) { minBackoff = d }(minBackoff)
+	minBackoff = time.Millisecond
+
+	addr := filepath.Join(t.TempDir(), "log")
+	// nothing listens yet: Dial must succeed and queue
+	w, err := Dial("unix", addr, LOG_USER|LOG_ERR, "syslog_test", WithBuffer(10))
+	if err != nil {
+		t.Fatalf("Dial with the server down: %v", err)
+	}
+	defer w.Close()
+	w.Info("early")
+
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	s, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || !strings.HasSuffix(s, ": early\n") {
+		t.Errorf("got %q, %v; want the early message", s, err)
+	}
+}
+
+func TestBufferedCloseStalled(t *testing.T) {
+	if !testableNetwork("unix") {
+		t.Skipf("skipping on %s/%s; 'unix' is not supported", runtime.GOOS, runtime.GOARCH)
+	}
+	defer func(d time.Duration) { sendTimeout = d }(sendTimeout)
+	sendTimeout = 100 * time.Millisecond
+
+	addr := filepath.Join(t.TempDir(), "log")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accept but never read
+		if c, err := l.Accept(); err == nil {
+			defer c.Close()
+			time.Sleep(10 * time.Second)
+		}
+	}()
+
+	w, err := Dial("unix", addr, LOG_USER|LOG_ERR, "syslog_test", WithBuffer(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("x", 1000)
+	for i := 0; i < 10000; i++ {
+		w.Info(line)
+	}
+	start := time.Now()
+	w.Close()
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Close took %v with a stalled server", d)
+	}
+	if w.Dropped() == 0 {
+		t.Error("no messages counted as dropped")
+	}
+}